@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// Attachments are images stored in the database. Card text refers to one
+// with markdown image syntax: ![diagram](attachment:12).
+
+type Attachment struct {
+	ID   int
+	Name string
+	Mime string
+	Data []byte
+}
+
+func runAttach(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: fcards attach add [-name NAME] FILE | fcards attach list")
+	}
+	switch args[0] {
+	case "add":
+		return addAttachmentFile(db, args[1:])
+	case "list":
+		return listAttachments(db)
+	default:
+		return fmt.Errorf("unknown attach command %q", args[0])
+	}
+}
+
+func addAttachmentFile(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("attach add", flag.ContinueOnError)
+	var name string
+	fs.StringVar(&name, "name", "", "name shown in place of the image (default: the file name)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: fcards attach add [-name NAME] FILE")
+	}
+	path := fs.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: not a PNG, JPEG or GIF image", path)
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	id, err := addAttachment(db, Attachment{Name: name, Mime: "image/" + format, Data: data})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Attached %s as %d. Use it in a card with:\n![%s](attachment:%d)\n", path, id, name, id)
+	return nil
+}
+
+func addAttachment(db *sql.DB, a Attachment) (int, error) {
+	res, err := db.Exec(`INSERT INTO attachments(name, mime, data) VALUES (?, ?, ?);`, a.Name, a.Mime, a.Data)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// loadAttachment returns nil when there is no attachment with id.
+func loadAttachment(db *sql.DB, id int) (*Attachment, error) {
+	a := Attachment{ID: id}
+	err := db.QueryRow(`SELECT name, mime, data FROM attachments WHERE id = ?;`, id).Scan(&a.Name, &a.Mime, &a.Data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func listAttachments(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, name, mime, length(data) FROM attachments ORDER BY id;`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTYPE\tSIZE")
+	for rows.Next() {
+		var id, size int
+		var name, mime string
+		if err := rows.Scan(&id, &name, &mime, &size); err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\n", id, name, mime, size)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Rendering a card runs every code fence through chroma, which is far too
+// slow to repeat on each key press and resize. Rendered lines are memoised
+// by card, layout and width, and the card after the current one is rendered
+// in the background so moving to it is instant.
+
+// renderCacheSize bounds the number of rendered layouts kept.
+const renderCacheSize = 128
+
+type renderKey struct {
+	layout      string
+	card        string
+	showAnswers bool
+	width       int
+	codeLang    string
+	wrap        bool
+}
+
+// renderCache maps a renderKey to rendered lines. It is shared with the
+// background precompute, hence the lock. Cached slices must not be modified.
+type renderCache struct {
+	mu      sync.Mutex
+	entries map[renderKey][]string
+	order   []renderKey
+}
+
+var cardLines = &renderCache{entries: make(map[renderKey][]string)}
+
+// lines returns the cached lines for key, rendering them on a miss. Once
+// full, the oldest entries are dropped first.
+func (c *renderCache) lines(key renderKey, render func() []string) []string {
+	c.mu.Lock()
+	lines, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return lines
+	}
+
+	lines = render()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		if len(c.order) >= renderCacheSize {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = lines
+	return lines
+}
+
+// cardCacheKey identifies a card by its content, so cards from a -deck
+// file without ids are told apart too.
+func cardCacheKey(q Question) string {
+	return q.Text + "\x00" + strings.Join(q.Answers, "\x00")
+}
+
+// precomputeNext renders the card after the current one, both sides, in
+// the current layout.
+func (m model) precomputeNext() tea.Cmd {
+	if m.mode != modeCards || m.index+1 >= len(m.questions) {
+		return nil
+	}
+	next := m
+	next.index++
+	next.scrollOffset, next.answerScroll, next.hScroll = 0, 0, 0
+	return func() tea.Msg {
+		for _, showAnswers := range []bool{false, true} {
+			next.showAnswers = showAnswers
+			next.maxScroll()
+			next.maxHScroll()
+		}
+		return nil
+	}
+}
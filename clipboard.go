@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Copying goes through OSC 52: the terminal itself sets the clipboard, so
+// it works over SSH and inside tmux or screen. Copied text is the card's
+// source without fences, never the rendered lines with their escapes.
+
+// clipboardSequence is the escape sequence that puts text on the clipboard,
+// wrapped for tmux or screen when running inside one.
+func clipboardSequence(text string) string {
+	seq := osc52.New(text)
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = seq.Tmux()
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = seq.Screen()
+	}
+	return seq.String()
+}
+
+// clipboardWriter writes a clipboard sequence while the UI has released
+// the terminal, so it cannot land in the middle of a frame. It is run
+// through tea.Exec.
+type clipboardWriter struct {
+	seq    string
+	stdout io.Writer
+}
+
+func (c *clipboardWriter) SetStdin(io.Reader)    {}
+func (c *clipboardWriter) SetStdout(w io.Writer) { c.stdout = w }
+func (c *clipboardWriter) SetStderr(io.Writer)   {}
+
+func (c *clipboardWriter) Run() error {
+	_, err := io.WriteString(c.stdout, c.seq)
+	return err
+}
+
+// copiedMsg reports that the clipboard sequence was written.
+type copiedMsg struct{ err error }
+
+func copyToClipboard(text string) tea.Cmd {
+	writer := &clipboardWriter{seq: clipboardSequence(text)}
+	return tea.Exec(writer, func(err error) tea.Msg { return copiedMsg{err} })
+}
+
+// codeBlocks returns the contents of the fenced code blocks in text, with
+// the fence's own indentation removed.
+func codeBlocks(text string) []string {
+	const fence = "```"
+
+	var blocks []string
+	var current []string
+	var indent string
+	inCode := false
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimRight(raw, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, fence) && !inCode:
+			inCode = true
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			current = nil
+		case strings.HasPrefix(trimmed, fence):
+			inCode = false
+			blocks = append(blocks, strings.Join(current, "\n"))
+		case inCode:
+			current = append(current, strings.TrimPrefix(line, indent))
+		}
+	}
+	if inCode {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+	return blocks
+}
+
+// copyText is text with its fence lines dropped, so an answer that is a
+// command or snippet pastes as just that.
+func copyText(text string) string {
+	var lines []string
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimRight(raw, "\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// cardCodeBlocks lists the code blocks shown on the current card, the
+// question's first.
+func (m model) cardCodeBlocks() []string {
+	q := m.questions[m.index]
+	blocks := codeBlocks(q.Text)
+	if m.showAnswers {
+		for _, a := range q.Answers {
+			blocks = append(blocks, codeBlocks(a)...)
+		}
+	}
+	return blocks
+}
+
+func (m model) copyAnswers() (model, tea.Cmd) {
+	q := m.questions[m.index]
+	if len(q.Answers) == 0 {
+		m.notice = palette.Error.paint("This card has no answers to copy")
+		return m, nil
+	}
+	texts := make([]string, len(q.Answers))
+	for i, a := range q.Answers {
+		texts[i] = copyText(a)
+	}
+	if len(texts) == 1 {
+		m.notice = "Copied the answer"
+	} else {
+		m.notice = fmt.Sprintf("Copied %d answers", len(texts))
+	}
+	return m, copyToClipboard(strings.Join(texts, "\n\n"))
+}
+
+// copyCodeKey reads the number of the code block to copy after the
+// copy_code key. The copy happens as soon as no further digit could make a
+// valid number, or on enter; any other key cancels.
+func (m model) copyCodeKey(msg tea.KeyMsg) (model, tea.Cmd) {
+	blocks := m.cardCodeBlocks()
+	key := keyName(msg)
+	if len(key) == 1 && key[0] >= '0' && key[0] <= '9' {
+		m.copyDigits += key
+		if n, _ := strconv.Atoi(m.copyDigits); n*10 <= len(blocks) {
+			return m, nil
+		}
+	} else if key != "enter" || m.copyDigits == "" {
+		m.copyPending = false
+		m.copyDigits = ""
+		return m, nil
+	}
+
+	n, _ := strconv.Atoi(m.copyDigits)
+	m.copyPending = false
+	m.copyDigits = ""
+	if n < 1 || n > len(blocks) {
+		m.notice = palette.Error.paint(fmt.Sprintf("No code block %d", n))
+		return m, nil
+	}
+	m.notice = fmt.Sprintf("Copied code block %d", n)
+	return m, copyToClipboard(blocks[n-1])
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// Fenced code can be drawn with line numbers and a frame whose top edge
+// names the language, see [code] in the config. The fence info string may
+// mark lines to emphasise, as in ```go {3,5-7}.
+
+// Symbols drawn around code blocks. Plain mode swaps them for ASCII.
+var (
+	glyphFrameTop    = "┌"
+	glyphFrameSide   = "│"
+	glyphFrameBottom = "└"
+	glyphFrameRule   = "─"
+	glyphMark        = "▌"
+)
+
+// parseFenceInfo splits the info string of a fence, such as "go {3,5-7}",
+// into the language and the set of lines to emphasise. A malformed line
+// list is ignored.
+func parseFenceInfo(info string) (string, map[int]bool) {
+	info = strings.TrimSpace(info)
+	open := strings.IndexByte(info, '{')
+	if open < 0 || !strings.HasSuffix(info, "}") {
+		return info, nil
+	}
+	lang := strings.TrimSpace(info[:open])
+	marked := make(map[int]bool)
+	for _, part := range strings.Split(info[open+1:len(info)-1], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || first < 1 {
+			return lang, nil
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || last < first {
+				return lang, nil
+			}
+		}
+		for n := first; n <= last; n++ {
+			marked[n] = true
+		}
+	}
+	return lang, marked
+}
+
+// codeLexer picks the lexer for lang, or guesses one from the code. It
+// returns nil when neither works.
+func codeLexer(code, lang string) chroma.Lexer {
+	if lexer := lexers.Get(lang); lexer != nil {
+		return lexer
+	}
+	return lexers.Analyse(code)
+}
+
+// codeLabel is the language shown on a code block's frame: the fence's
+// own, or the name of the lexer guessed from the code.
+func codeLabel(code, lang string) string {
+	if lang != "" {
+		return lang
+	}
+	if lexer := codeLexer(code, ""); lexer != nil {
+		return strings.ToLower(lexer.Config().Name)
+	}
+	return ""
+}
+
+// renderCodeBlock renders the body of a fence opened with info. Without
+// colour the code is not highlighted and always gets line numbers.
+func renderCodeBlock(code, info, defaultLang string, width int) []string {
+	lang, marked := parseFenceInfo(info)
+	if lang == "" {
+		lang = defaultLang
+	}
+	code = expandTabs(code, 4)
+
+	var lines []string
+	if noColor {
+		lines = strings.Split(code, "\n")
+	} else {
+		lines = strings.Split(strings.TrimSuffix(highlightCode(code, lang), "\n"), "\n")
+	}
+	numbered := cfg.Code.LineNumbers || noColor
+	digits := len(fmt.Sprint(len(lines)))
+	for i, line := range lines {
+		n := i + 1
+		var gutter strings.Builder
+		if cfg.Code.Frame {
+			gutter.WriteString(palette.Muted.paint(glyphFrameSide) + " ")
+		}
+		if len(marked) > 0 {
+			if marked[n] {
+				gutter.WriteString(palette.Selection.paint(glyphMark))
+			} else {
+				gutter.WriteString(" ")
+			}
+		}
+		if numbered {
+			style := palette.Muted
+			if marked[n] {
+				style = palette.Selection
+			}
+			gutter.WriteString(style.paint(fmt.Sprintf("%*d", digits, n)) + palette.Muted.paint(" | "))
+		} else if len(marked) > 0 {
+			gutter.WriteString(" ")
+		}
+		lines[i] = gutter.String() + line
+	}
+	if !cfg.Code.Frame {
+		return lines
+	}
+
+	top := glyphFrameTop + glyphFrameRule
+	if label := codeLabel(code, lang); label != "" {
+		top += " " + label + " "
+	}
+	top += strings.Repeat(glyphFrameRule, max(0, width-visualWidth(top)))
+	bottom := glyphFrameBottom + strings.Repeat(glyphFrameRule, max(0, width-1))
+	lines = append([]string{palette.Muted.paint(top)}, lines...)
+	return append(lines, palette.Muted.paint(bottom))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// runCommand dispatches the non-interactive subcommands, e.g. `fcards export`.
+func runCommand(db *sql.DB, name string, args []string) error {
+	switch name {
+	case "export":
+		return runExport(db, args)
+	case "import":
+		return runImport(db, args)
+	case "sync":
+		return runSync(db, args)
+	case "list":
+		return runList(db, args)
+	case "show":
+		return runShow(db, args)
+	case "search":
+		return runSearch(db, args)
+	case "deck":
+		return runDeck(db, args)
+	case "attach":
+		return runAttach(db, args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Config holds the settings read from config.toml. Command-line flags
+// default to these values, so a flag always wins over the file.
+type Config struct {
+	Type    string `toml:"type"`
+	Group   string `toml:"group"`
+	Profile string `toml:"profile"`
+
+	// CardWidth is the card width in columns; 0 means half the terminal.
+	CardWidth    int `toml:"card_width"`
+	CardMinWidth int `toml:"card_min_width"`
+
+	// Theme names a built-in theme (dark, light, high-contrast) or one of
+	// Themes. ChromaStyle and Colors.Accent override the theme when set.
+	Theme       string           `toml:"theme"`
+	Themes      map[string]Theme `toml:"themes,omitempty"`
+	ChromaStyle string           `toml:"chroma_style"`
+	// SoftWrap wraps long code lines instead of scrolling them sideways.
+	SoftWrap bool `toml:"soft_wrap"`
+	// SplitMinWidth is the terminal width from which question and answers
+	// are shown side by side; 0 turns the split layout off.
+	SplitMinWidth int `toml:"split_min_width"`
+	// Images picks how attached images are drawn: auto, kitty, iterm,
+	// sixel, or none for placeholders only.
+	Images string `toml:"images"`
+
+	Colors ColorConfig `toml:"colors"`
+	Code   CodeConfig  `toml:"code"`
+	Study  StudyConfig `toml:"study"`
+	Keys   KeysConfig  `toml:"keys"`
+}
+
+type ColorConfig struct {
+	Accent string `toml:"accent"`
+}
+
+// CodeConfig controls how fenced code blocks are drawn.
+type CodeConfig struct {
+	LineNumbers bool `toml:"line_numbers"`
+	// Frame draws a rule around the block with the language on top.
+	Frame bool `toml:"frame"`
+}
+
+// StudyConfig holds the session defaults that decks inherit unless they
+// set their own.
+type StudyConfig struct {
+	Shuffle      bool `toml:"shuffle"`
+	SessionLimit int  `toml:"session_limit"`
+}
+
+// KeysConfig picks a key preset and overrides individual actions, e.g.
+// next = ["space", "l"] under [keys.cards].
+type KeysConfig struct {
+	Preset      string   `toml:"preset"`
+	ConfirmQuit bool     `toml:"confirm_quit"`
+	Cards       bindings `toml:"cards,omitempty"`
+	Group       bindings `toml:"group,omitempty"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		CardMinWidth:  34,
+		Theme:         "dark",
+		SplitMinWidth: 160,
+		Images:        "auto",
+		Study:         StudyConfig{Shuffle: true},
+		Keys:          KeysConfig{Preset: "vim", ConfirmQuit: true},
+	}
+}
+
+// cfg is the effective configuration, set up once in main.
+var cfg = defaultConfig()
+
+// getConfigDir returns $XDG_CONFIG_HOME/fcards, or ~/.config/fcards.
+func getConfigDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "fcards"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "fcards"), nil
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("FCARDS_CONFIG"); path != "" {
+		return expandHome(path), nil
+	}
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// loadConfig reads the config file on top of the defaults. A missing file
+// is not an error.
+func loadConfig(path string) (Config, error) {
+	c := defaultConfig()
+	md, err := toml.DecodeFile(path, &c)
+	if os.IsNotExist(err) {
+		return defaultConfig(), nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		return c, fmt.Errorf("unknown settings: %s", strings.Join(keys, ", "))
+	}
+	return c, c.validate()
+}
+
+func (c Config) validate() error {
+	if _, ok := parseColor(c.Colors.Accent); c.Colors.Accent != "" && !ok {
+		return fmt.Errorf("colors.accent: invalid color %q", c.Colors.Accent)
+	}
+	if _, ok := styles.Registry[c.ChromaStyle]; c.ChromaStyle != "" && !ok {
+		return fmt.Errorf("chroma_style: unknown style %q", c.ChromaStyle)
+	}
+	if c.CardWidth < 0 || c.CardMinWidth < 0 || c.SplitMinWidth < 0 {
+		return fmt.Errorf("card_width, card_min_width and split_min_width must not be negative")
+	}
+	switch c.Images {
+	case "auto", protocolKitty, protocolITerm, protocolSixel, "none":
+	default:
+		return fmt.Errorf("images: must be auto, kitty, iterm, sixel or none, not %q", c.Images)
+	}
+	if c.Study.SessionLimit < 0 {
+		return fmt.Errorf("study.session_limit must not be negative")
+	}
+	return nil
+}
+
+func runConfig(path string, args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch fs.Arg(0) {
+	case "show", "":
+		fmt.Printf("# %s\n", path)
+		return toml.NewEncoder(os.Stdout).Encode(cfg)
+	case "path":
+		fmt.Println(path)
+		return nil
+	default:
+		return fmt.Errorf("unknown config command %q", fs.Arg(0))
+	}
+}
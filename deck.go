@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A deck file is plain markdown:
+//
+//	---
+//	type: general
+//	---
+//
+//	## Which SQL clause filters rows? <!-- id: 3f2a... -->
+//	- WHERE
+//
+// Every `## ` heading starts a card. Lines between the heading and the first
+// `- ` item continue the question, and each top-level `- ` item is one
+// answer, with further lines indented by two spaces. The HTML comment on the
+// heading carries the card's stable id, its tags and, when it differs from
+// the front matter, its type.
+
+const deckFence = "```"
+
+type deckMeta struct {
+	Key   string
+	Value string
+}
+
+type deckFile struct {
+	Type     string
+	Meta     []deckMeta
+	Preamble []string
+	Cards    []Question
+}
+
+func deckFromQuestions(questions []Question) deckFile {
+	deck := deckFile{Cards: questions}
+	for i, q := range questions {
+		if i == 0 {
+			deck.Type = q.Type
+		} else if q.Type != deck.Type {
+			deck.Type = ""
+			break
+		}
+	}
+	return deck
+}
+
+// loadDeckQuestions reads the cards of a markdown or CSV deck, or of stdin
+// when path is "-", without going through the database.
+func loadDeckQuestions(path string) ([]Question, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	isCSV := strings.EqualFold(filepath.Ext(path), ".csv")
+	if path == "-" {
+		text := strings.TrimLeft(string(data), "\n")
+		isCSV = !strings.HasPrefix(text, "---") && !strings.HasPrefix(text, "## ") &&
+			!strings.Contains(text, "\n## ")
+	}
+	if isCSV {
+		return readCSV(bytes.NewReader(data))
+	}
+	deck, err := parseDeck(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return deck.Cards, nil
+}
+
+func parseDeck(r io.Reader) (deckFile, error) {
+	var deck deckFile
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return deck, err
+	}
+
+	i := 0
+	if len(lines) > 0 && lines[0] == "---" {
+		closed := false
+		for i = 1; i < len(lines); i++ {
+			if lines[i] == "---" {
+				closed = true
+				i++
+				break
+			}
+			key, value, ok := strings.Cut(lines[i], ":")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			value = strings.TrimSpace(value)
+			if key == "type" {
+				deck.Type = value
+			} else {
+				deck.Meta = append(deck.Meta, deckMeta{Key: key, Value: value})
+			}
+		}
+		if !closed {
+			return deck, fmt.Errorf("front matter is not closed with ---")
+		}
+	}
+
+	var card *Question
+	var body []string
+	var answer []string
+	inAnswers := false
+	inCode := false
+
+	flushAnswer := func() {
+		if answer != nil {
+			card.Answers = append(card.Answers, strings.Join(trimTrailingBlank(answer), "\n"))
+			answer = nil
+		}
+	}
+	flushCard := func() {
+		if card == nil {
+			return
+		}
+		flushAnswer()
+		if body = trimTrailingBlank(body); len(body) > 0 {
+			card.Text += "\n" + strings.Join(body, "\n")
+		}
+		deck.Cards = append(deck.Cards, *card)
+		card = nil
+		body = nil
+		inAnswers = false
+		inCode = false
+	}
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if !inCode && strings.HasPrefix(line, "## ") {
+			flushCard()
+			text, attrs := splitHeadingAttrs(strings.TrimPrefix(line, "## "))
+			card = &Question{Text: text, Type: deck.Type, UID: attrs["id"], Tags: splitTags(attrs["tags"])}
+			if t, ok := attrs["type"]; ok {
+				card.Type = t
+			}
+			continue
+		}
+		if card == nil {
+			deck.Preamble = append(deck.Preamble, line)
+			continue
+		}
+
+		if !inCode && (strings.HasPrefix(line, "- ") || line == "-") {
+			flushAnswer()
+			inAnswers = true
+			answer = []string{strings.TrimPrefix(strings.TrimPrefix(line, "-"), " ")}
+			inCode = isFenceLine(answer[0])
+			continue
+		}
+
+		if inAnswers {
+			line = strings.TrimPrefix(line, "  ")
+			if isFenceLine(line) {
+				inCode = !inCode
+			}
+			answer = append(answer, line)
+			continue
+		}
+
+		if isFenceLine(line) {
+			inCode = !inCode
+		} else if !inCode && strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		body = append(body, line)
+	}
+	flushCard()
+
+	for len(deck.Preamble) > 0 && strings.TrimSpace(deck.Preamble[0]) == "" {
+		deck.Preamble = deck.Preamble[1:]
+	}
+	deck.Preamble = trimTrailingBlank(deck.Preamble)
+	return deck, nil
+}
+
+func writeDeck(w io.Writer, deck deckFile) error {
+	bw := bufio.NewWriter(w)
+	if deck.Type != "" || len(deck.Meta) > 0 {
+		bw.WriteString("---\n")
+		if deck.Type != "" {
+			fmt.Fprintf(bw, "type: %s\n", deck.Type)
+		}
+		for _, meta := range deck.Meta {
+			fmt.Fprintf(bw, "%s: %s\n", meta.Key, meta.Value)
+		}
+		bw.WriteString("---\n\n")
+	}
+	for _, line := range deck.Preamble {
+		bw.WriteString(line + "\n")
+	}
+	if len(deck.Preamble) > 0 {
+		bw.WriteString("\n")
+	}
+
+	for i, q := range deck.Cards {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		lines := strings.Split(strings.TrimRight(q.Text, "\n"), "\n")
+		heading := "## " + lines[0]
+		var attrs []string
+		if q.UID != "" {
+			attrs = append(attrs, "id: "+q.UID)
+		}
+		if q.Type != deck.Type {
+			attrs = append(attrs, "type: "+q.Type)
+		}
+		if len(q.Tags) > 0 {
+			attrs = append(attrs, "tags: "+strings.Join(q.Tags, ", "))
+		}
+		if len(attrs) > 0 {
+			heading += " <!-- " + strings.Join(attrs, "; ") + " -->"
+		}
+		bw.WriteString(heading + "\n")
+
+		inCode := false
+		for _, line := range lines[1:] {
+			if isFenceLine(line) {
+				inCode = !inCode
+			} else if !inCode && needsDeckEscape(line) {
+				line = `\` + line
+			}
+			bw.WriteString(line + "\n")
+		}
+
+		if len(q.Answers) > 0 {
+			bw.WriteString("\n")
+		}
+		for _, ans := range q.Answers {
+			for j, line := range strings.Split(ans, "\n") {
+				switch {
+				case j == 0 && line == "":
+					line = "-"
+				case j == 0:
+					line = "- " + line
+				case line != "":
+					line = "  " + line
+				}
+				bw.WriteString(line + "\n")
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// splitHeadingAttrs separates a card heading from its trailing
+// `<!-- key: value; ... -->` comment. Only the one space writeDeck puts
+// before the comment is dropped, so a question whose first line ends in
+// spaces keeps them.
+func splitHeadingAttrs(heading string) (string, map[string]string) {
+	attrs := map[string]string{}
+	trimmed := strings.TrimRight(heading, " ")
+	if !strings.HasSuffix(trimmed, "-->") {
+		return heading, attrs
+	}
+	start := strings.LastIndex(trimmed, "<!--")
+	if start < 0 {
+		return heading, attrs
+	}
+	inner := strings.TrimSuffix(trimmed[start+len("<!--"):], "-->")
+	for _, part := range strings.Split(inner, ";") {
+		key, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		attrs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return strings.TrimSuffix(trimmed[:start], " "), attrs
+}
+
+func needsDeckEscape(line string) bool {
+	return strings.HasPrefix(line, "- ") || line == "-" ||
+		strings.HasPrefix(line, "## ") || strings.HasPrefix(line, `\`)
+}
+
+func isFenceLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), deckFence)
+}
+
+func trimTrailingBlank(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDeckRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		deck deckFile
+	}{
+		{
+			name: "front matter and plain cards",
+			deck: deckFile{
+				Type: "sql",
+				Meta: []deckMeta{{Key: "title", Value: "SQL basics"}},
+				Cards: []Question{
+					{UID: "a1", Type: "sql", Text: "Which clause filters rows?", Answers: []string{"WHERE"}},
+					{UID: "a2", Type: "sql", Text: "Which clause filters groups?", Answers: []string{"HAVING", "not WHERE"}},
+				},
+			},
+		},
+		{
+			name: "nested type and tags",
+			deck: deckFile{
+				Type: "go",
+				Cards: []Question{
+					{UID: "b1", Type: "go::concurrency::channels", Tags: []string{"interview", "go"}, Text: "Who closes a channel?", Answers: []string{"The sender"}},
+				},
+			},
+		},
+		{
+			name: "fenced code in question and answer",
+			deck: deckFile{
+				Cards: []Question{{
+					UID:  "c1",
+					Type: "go",
+					Text: "What does this print?\n```go\n- not an answer\n## not a heading\nfmt.Println(1)\n```",
+					Answers: []string{
+						"```\n1\n```",
+						"It prints:\n\n```\n- one\n## two\n```",
+					},
+				}},
+			},
+		},
+		{
+			name: "question lines that look like deck syntax",
+			deck: deckFile{
+				Cards: []Question{{
+					UID:     "d1",
+					Text:    "Which of these is a list item?\n- apples\n-\n## oranges\n\\escaped",
+					Answers: []string{"The first"},
+				}},
+			},
+		},
+		{
+			name: "empty answers",
+			deck: deckFile{
+				Cards: []Question{{
+					UID:     "e1",
+					Text:    "Name three things",
+					Answers: []string{"", "second", ""},
+				}},
+			},
+		},
+		{
+			name: "no answers",
+			deck: deckFile{
+				Cards: []Question{
+					{UID: "f1", Text: "A card without answers"},
+					{UID: "f2", Text: "Another card", Answers: []string{"one"}},
+				},
+			},
+		},
+		{
+			name: "trailing spaces on the first question line",
+			deck: deckFile{
+				Cards: []Question{
+					{UID: "g1", Text: "Ends in spaces  ", Answers: []string{"yes"}},
+					{Text: "No id either ", Answers: []string{"yes"}},
+				},
+			},
+		},
+		{
+			name: "preamble before the first card",
+			deck: deckFile{
+				Type:     "git",
+				Preamble: []string{"# Git", "", "Notes on git."},
+				Cards: []Question{
+					{UID: "h1", Type: "git", Text: "List branches?", Answers: []string{"git branch"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeDeck(&buf, tt.deck); err != nil {
+				t.Fatalf("writeDeck: %v", err)
+			}
+			got, err := parseDeck(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("parseDeck: %v\n%s", err, buf.String())
+			}
+			if len(got.Preamble) == 0 {
+				got.Preamble = nil
+			}
+			if !reflect.DeepEqual(got, tt.deck) {
+				t.Errorf("round trip changed the deck\nwrote:\n%s\ngot:  %#v\nwant: %#v", buf.String(), got, tt.deck)
+			}
+		})
+	}
+}
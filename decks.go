@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// deckSettings is a row of the decks table. Empty strings and NULLs mean
+// "inherit from the parent deck".
+type deckSettings struct {
+	Name         string
+	Description  string
+	Color        string
+	CodeLang     string
+	Shuffle      sql.NullBool
+	SessionLimit sql.NullInt64
+}
+
+// Deck is the effective configuration of a deck after inheritance.
+type Deck struct {
+	Name         string
+	Description  string
+	Color        string
+	CodeLang     string
+	Shuffle      bool
+	SessionLimit int
+}
+
+func loadDecks(db *sql.DB) (map[string]deckSettings, error) {
+	rows, err := db.Query(`
+		SELECT name, description, color, code_lang, shuffle, session_limit
+		FROM decks
+		ORDER BY name;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decks := make(map[string]deckSettings)
+	for rows.Next() {
+		var d deckSettings
+		if err := rows.Scan(&d.Name, &d.Description, &d.Color, &d.CodeLang, &d.Shuffle, &d.SessionLimit); err != nil {
+			return nil, err
+		}
+		decks[d.Name] = d
+	}
+	return decks, rows.Err()
+}
+
+func saveDeck(db *sql.DB, d deckSettings) error {
+	_, err := db.Exec(`
+		INSERT INTO decks(name, description, color, code_lang, shuffle, session_limit)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			description = excluded.description,
+			color = excluded.color,
+			code_lang = excluded.code_lang,
+			shuffle = excluded.shuffle,
+			session_limit = excluded.session_limit;`,
+		d.Name, d.Description, d.Color, d.CodeLang, d.Shuffle, d.SessionLimit)
+	return err
+}
+
+// resolveDeck returns the effective settings for a deck path. Sub-decks
+// inherit the colour, code language and study settings of the nearest
+// ancestor that sets them; the description is never inherited.
+func resolveDeck(decks map[string]deckSettings, path string) Deck {
+	resolved := Deck{Name: path, Shuffle: cfg.Study.Shuffle, SessionLimit: cfg.Study.SessionLimit}
+	parts := strings.Split(path, deckSeparator)
+	for i := range parts {
+		d, ok := decks[strings.Join(parts[:i+1], deckSeparator)]
+		if !ok {
+			continue
+		}
+		if d.Color != "" {
+			resolved.Color = d.Color
+		}
+		if d.CodeLang != "" {
+			resolved.CodeLang = d.CodeLang
+		}
+		if d.Shuffle.Valid {
+			resolved.Shuffle = d.Shuffle.Bool
+		}
+		if d.SessionLimit.Valid {
+			resolved.SessionLimit = int(d.SessionLimit.Int64)
+		}
+		if i == len(parts)-1 {
+			resolved.Description = d.Description
+		}
+	}
+	return resolved
+}
+
+// prepareSession orders and trims questions for a study session according
+// to the deck's settings.
+func prepareSession(questions []Question, deck Deck) []Question {
+	if deck.Shuffle {
+		shuffleQuestions(questions)
+	}
+	if deck.SessionLimit > 0 && len(questions) > deck.SessionLimit {
+		questions = questions[:deck.SessionLimit]
+	}
+	return questions
+}
+
+// accentColor turns a deck colour into an escape sequence, falling back to
+// the theme's border colour when the deck has none.
+func accentColor(spec string) string {
+	if noColor {
+		return ""
+	}
+	if code, ok := parseColor(spec); ok {
+		return code
+	}
+	return palette.Border.on
+}
+
+// parseColor accepts a 256-colour palette index such as "208" or a
+// "#rrggbb" hex value.
+func parseColor(spec string) (string, bool) {
+	params, ok := colorParams(spec, false)
+	if !ok {
+		return "", false
+	}
+	return "\033[" + params + "m", true
+}
+
+// colorParams returns the SGR parameters selecting a colour as foreground,
+// or as background when background is set.
+func colorParams(spec string, background bool) (string, bool) {
+	target := 38
+	if background {
+		target = 48
+	}
+	spec = strings.TrimSpace(spec)
+	if n, err := strconv.Atoi(spec); err == nil && n >= 0 && n <= 255 {
+		return fmt.Sprintf("%d;5;%d", target, n), true
+	}
+	if len(spec) == 7 && spec[0] == '#' {
+		if v, err := strconv.ParseUint(spec[1:], 16, 32); err == nil {
+			return fmt.Sprintf("%d;2;%d;%d;%d", target, v>>16&0xff, v>>8&0xff, v&0xff), true
+		}
+	}
+	return "", false
+}
+
+func runDeck(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: fcards deck list | fcards deck set NAME [flags]")
+	}
+	switch args[0] {
+	case "list":
+		return listDecks(db)
+	case "set":
+		return setDeck(db, args[1:])
+	default:
+		return fmt.Errorf("unknown deck command %q", args[0])
+	}
+}
+
+func listDecks(db *sql.DB) error {
+	decks, err := loadDecks(db)
+	if err != nil {
+		return err
+	}
+	groups, err := loadTypeGroups(db)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for name := range decks {
+		names[name] = true
+	}
+	for _, row := range groupRows(groups, true, allExpanded(groups), "") {
+		names[row.Path] = true
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DECK\tCOLOR\tLANG\tSHUFFLE\tLIMIT\tDESCRIPTION")
+	for _, name := range sortedKeys(names) {
+		d := resolveDeck(decks, name)
+		label := name
+		if label == "" {
+			label = "(none)"
+		}
+		limit := "-"
+		if d.SessionLimit > 0 {
+			limit = strconv.Itoa(d.SessionLimit)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\n", label, d.Color, d.CodeLang, d.Shuffle, limit, d.Description)
+	}
+	return tw.Flush()
+}
+
+func setDeck(db *sql.DB, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: fcards deck set NAME [-description TEXT] [-color 208|#rrggbb] [-lang go] [-shuffle=false] [-limit N]")
+	}
+	name := args[0]
+	decks, err := loadDecks(db)
+	if err != nil {
+		return err
+	}
+	d, ok := decks[name]
+	if !ok {
+		d = deckSettings{Name: name}
+	}
+
+	var shuffle bool
+	var limit int
+	fs := flag.NewFlagSet("deck set", flag.ContinueOnError)
+	fs.StringVar(&d.Description, "description", d.Description, "what the deck is for")
+	fs.StringVar(&d.Color, "color", d.Color, "accent colour: a 256-colour index or #rrggbb")
+	fs.StringVar(&d.CodeLang, "lang", d.CodeLang, "language for code fences without one")
+	fs.BoolVar(&shuffle, "shuffle", true, "shuffle cards at the start of a session")
+	fs.IntVar(&limit, "limit", 0, "maximum cards per session (0 for no limit)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "shuffle":
+			d.Shuffle = sql.NullBool{Bool: shuffle, Valid: true}
+		case "limit":
+			d.SessionLimit = sql.NullInt64{Int64: int64(limit), Valid: true}
+		}
+	})
+	if _, ok := parseColor(d.Color); d.Color != "" && !ok {
+		return fmt.Errorf("invalid color %q", d.Color)
+	}
+	if limit < 0 {
+		return fmt.Errorf("-limit must not be negative")
+	}
+	return saveDeck(db, d)
+}
+
+func allExpanded(groups []TypeGroup) map[string]bool {
+	expanded := make(map[string]bool)
+	for _, g := range groups {
+		parts := strings.Split(g.Type, deckSeparator)
+		for i := range parts {
+			expanded[strings.Join(parts[:i+1], deckSeparator)] = true
+		}
+	}
+	return expanded
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
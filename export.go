@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type exportCard struct {
+	ID       int      `json:"id" yaml:"id"`
+	UID      string   `json:"uid" yaml:"uid"`
+	Type     string   `json:"type" yaml:"type"`
+	Tags     []string `json:"tags" yaml:"tags"`
+	Question string   `json:"question" yaml:"question"`
+	Answers  []string `json:"answers" yaml:"answers"`
+}
+
+func runExport(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var format string
+	var typeFilter string
+	var tagFilter string
+	var notTagFilter string
+	var output string
+	fs.StringVar(&format, "format", "json", "output format (json, yaml, csv, md)")
+	fs.StringVar(&typeFilter, "type", "", "only export questions of this type")
+	fs.StringVar(&tagFilter, "tag", "", "only export questions with all of these comma-separated tags")
+	fs.StringVar(&notTagFilter, "not-tag", "", "skip questions with any of these comma-separated tags")
+	fs.StringVar(&output, "o", "", "write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var write func(io.Writer, []Question) error
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "json":
+		write = writeJSON
+	case "yaml", "yml":
+		write = writeYAML
+	case "csv":
+		write = writeCSV
+	case "md", "markdown":
+		write = func(w io.Writer, questions []Question) error {
+			return writeDeck(w, deckFromQuestions(questions))
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	questions, err := loadQuestions(db, questionFilter{
+		Type:        typeFilter,
+		Tags:        splitTags(tagFilter),
+		ExcludeTags: splitTags(notTagFilter),
+	})
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return write(os.Stdout, questions)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := write(f, questions); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func toExportCards(questions []Question) []exportCard {
+	cards := make([]exportCard, 0, len(questions))
+	for _, q := range questions {
+		answers := q.Answers
+		if answers == nil {
+			answers = []string{}
+		}
+		tags := q.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		cards = append(cards, exportCard{ID: q.ID, UID: q.UID, Type: q.Type, Tags: tags, Question: q.Text, Answers: answers})
+	}
+	return cards
+}
+
+func writeJSON(w io.Writer, questions []Question) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// Keep <-chan and && readable in a diff of the export.
+	enc.SetEscapeHTML(false)
+	return enc.Encode(toExportCards(questions))
+}
+
+func writeYAML(w io.Writer, questions []Question) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(toExportCards(questions)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeCSV writes one row per question. The first answer goes in the
+// "answer" column and any further answers follow as extra columns, so the
+// order of answers is kept.
+func writeCSV(w io.Writer, questions []Question) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "uid", "type", "tags", "question", "answer"}); err != nil {
+		return err
+	}
+	for _, q := range questions {
+		record := []string{strconv.Itoa(q.ID), q.UID, q.Type, strings.Join(q.Tags, ","), q.Text}
+		record = append(record, q.Answers...)
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readCSV reads the layout written by writeCSV. Files without a header row
+// are read as question followed by its answers.
+func readCSV(r io.Reader) ([]Question, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	col := map[string]int{"id": -1, "uid": -1, "type": -1, "tags": -1, "question": 0, "answer": 1}
+	if hasHeader := slices.Contains(records[0], "question"); hasHeader {
+		for name := range col {
+			col[name] = slices.Index(records[0], name)
+		}
+		if col["answer"] < 0 {
+			col["answer"] = len(records[0])
+		}
+		records = records[1:]
+	}
+
+	field := func(record []string, name string) string {
+		if i := col[name]; i >= 0 && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	questions := make([]Question, 0, len(records))
+	for _, record := range records {
+		q := Question{
+			UID:  field(record, "uid"),
+			Type: field(record, "type"),
+			Tags: splitTags(field(record, "tags")),
+			Text: field(record, "question"),
+		}
+		q.ID, _ = strconv.Atoi(field(record, "id"))
+		if strings.TrimSpace(q.Text) == "" {
+			continue
+		}
+		if col["answer"] < len(record) {
+			for _, ans := range record[col["answer"]:] {
+				if ans != "" {
+					q.Answers = append(q.Answers, ans)
+				}
+			}
+		}
+		questions = append(questions, q)
+	}
+	return questions, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// actionHelp describes every action per mode. The help overlay and the
+// footer hints are both generated from it and the active keymap, so they
+// always show the keys that actually work.
+var actionHelp = map[int]map[string]string{
+	modeCards: {
+		actFlip:        "flip the card",
+		actNext:        "next card",
+		actPrev:        "previous card",
+		actUp:          "scroll up",
+		actDown:        "scroll down",
+		actScrollLeft:  "scroll long lines left (previous card if none)",
+		actScrollRight: "scroll long lines right (next card if none)",
+		actWrap:        "toggle soft wrap of long lines",
+		actSplit:       "toggle side-by-side panes on wide terminals",
+		actFocus:       "switch the pane that scrolls",
+		actCopy:        "copy the answers to the clipboard",
+		actCopyCode:    "copy code block N (type its number)",
+		actImages:      "show the card's images",
+		actFirst:       "first card",
+		actLast:        "last card",
+		actSearch:      "search cards",
+		actNextMatch:   "next match",
+		actPrevMatch:   "previous match",
+		actHelp:        "toggle this help",
+		actQuit:        "quit",
+	},
+	modeGroup: {
+		actUp:       "move up",
+		actDown:     "move down",
+		actOpen:     "study the selected group",
+		actExpand:   "expand deck",
+		actCollapse: "collapse deck / go to parent",
+		actSearch:   "filter groups",
+		actHelp:     "toggle this help",
+		actQuit:     "quit",
+	},
+}
+
+// searchHelp lists the keys of the search prompt, which reads text rather
+// than going through the keymap.
+var searchHelp = []helpEntry{
+	{"type", "edit the query"},
+	{"backspace", "delete a character"},
+	{"enter", "run the search / keep the filter"},
+	{"esc", "close the prompt (cancels a card search)"},
+	{"ctrl+c", "quit"},
+}
+
+type helpEntry struct {
+	Keys string
+	Desc string
+}
+
+// help lists the bindings of mode in the keymap's action order.
+func (k *Keymap) help(mode int) []helpEntry {
+	actions, b := cardActions, k.Cards
+	if mode == modeGroup {
+		actions, b = groupActions, k.Group
+	}
+	var entries []helpEntry
+	for _, action := range actions {
+		if len(b[action]) == 0 {
+			continue
+		}
+		entries = append(entries, helpEntry{Keys: strings.Join(b[action], ", "), Desc: actionHelp[mode][action]})
+	}
+	return entries
+}
+
+// key returns the first key bound to action in mode, or "" if it has none.
+func (k *Keymap) key(mode int, action string) string {
+	b := k.Cards
+	if mode == modeGroup {
+		b = k.Group
+	}
+	if seqs := b[action]; len(seqs) > 0 {
+		return seqs[0]
+	}
+	return ""
+}
+
+type hint struct {
+	Label   string
+	Actions []string
+}
+
+// hints builds a footer such as "h/l: prev/next  •  enter: flip" from the
+// first key of each action. Hints whose actions are unbound are left out.
+func (k *Keymap) hints(mode int, items ...hint) string {
+	var parts []string
+	for _, item := range items {
+		keys := make([]string, 0, len(item.Actions))
+		for _, action := range item.Actions {
+			if key := k.key(mode, action); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == len(item.Actions) {
+			parts = append(parts, strings.Join(keys, "/")+": "+item.Label)
+		}
+	}
+	return strings.Join(parts, "  •  ")
+}
+
+// fitHints is hints cut down to the leading items that fit in width.
+func (k *Keymap) fitHints(mode, width int, items ...hint) string {
+	for n := len(items); n > 1; n-- {
+		if footer := k.hints(mode, items[:n]...); visualWidth(footer) <= width {
+			return footer
+		}
+	}
+	return k.hints(mode, items[:min(1, len(items))]...)
+}
+
+// helpRows lays out the entries for a help box of width columns: keys on
+// the left, descriptions wrapped beside them.
+func helpRows(entries []helpEntry, width int) []string {
+	text := width - 4
+	keyWidth := 0
+	for _, e := range entries {
+		keyWidth = max(keyWidth, visualWidth(e.Keys))
+	}
+	keyWidth = min(keyWidth, text/2)
+
+	var rows []string
+	for _, e := range entries {
+		for i, desc := range wrapLines(e.Desc, max(text-keyWidth-2, 1)) {
+			keys := ""
+			if i == 0 {
+				keys = e.Keys
+			}
+			rows = append(rows, padRight(keys, keyWidth)+"  "+desc)
+		}
+	}
+	return rows
+}
+
+// helpVisibleRows is how many rows of entries fit on a screen of height
+// lines next to the borders, title and footer.
+func helpVisibleRows(height int) int {
+	if height <= 0 {
+		return 1 << 30
+	}
+	return max(height-6, 1)
+}
+
+// helpMaxScroll is how far the help for entries can scroll.
+func helpMaxScroll(entries []helpEntry, width, height int) int {
+	return max(0, len(helpRows(entries, width))-helpVisibleRows(height))
+}
+
+func renderHelp(mode int, title string, entries []helpEntry, width, height, scroll int) string {
+	inner := width - 2
+	accent := accentColor("")
+	line := func(text string) string {
+		return accent + "|" + reset + " " + padRight(text, inner-2) + " " + accent + "|" + reset
+	}
+
+	rows := helpRows(entries, width)
+	visible := min(len(rows), helpVisibleRows(height))
+	scroll = clampScroll(scroll, len(rows)-visible)
+	footer := "Press any key to close"
+	if visible < len(rows) {
+		if keys := keymap.hints(mode, hint{"scroll", []string{actUp, actDown}}); keys != "" {
+			footer = fmt.Sprintf("%s  •  %d-%d of %d  •  any other key: close", keys, scroll+1, scroll+visible, len(rows))
+		}
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(accent + "+" + strings.Repeat("-", inner) + "+\n" + reset)
+	builder.WriteString(line("Keys — "+title) + "\n")
+	builder.WriteString(accent + "+" + strings.Repeat("-", inner) + "+\n" + reset)
+	for _, row := range rows[scroll : scroll+visible] {
+		builder.WriteString(line(row) + "\n")
+	}
+	builder.WriteString(line("") + "\n")
+	builder.WriteString(line(footer) + "\n")
+	builder.WriteString(accent + "+" + strings.Repeat("-", inner) + "+" + reset)
+	return padToHeight(builder.String()+"\n", height)
+}
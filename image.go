@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"image"
+	colorpalette "image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Images referenced from card text are drawn with the kitty graphics
+// protocol, iTerm2 inline images or sixel, whichever the terminal speaks.
+// Each encoder returns the escape sequence as a string. The full-screen UI
+// redraws the screen line by line, which would tear an image apart, so
+// cards show a placeholder there and the images key opens them full
+// screen; `fcards show` draws them inline.
+
+const (
+	protocolKitty = "kitty"
+	protocolITerm = "iterm"
+	protocolSixel = "sixel"
+)
+
+// Images are sized assuming terminal cells of about this many pixels.
+const (
+	cellWidth  = 10
+	cellHeight = 20
+)
+
+var imagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(attachment:(\d+)\)`)
+
+// imageSource and imageProtocol are set where images are drawn inline.
+// While imageSource is nil, references render as placeholders.
+var (
+	imageSource   *sql.DB
+	imageProtocol string
+)
+
+// detectImageProtocol resolves the images setting. "auto" goes by the
+// environment; inside tmux or screen images are off unless set explicitly.
+func detectImageProtocol(setting string) string {
+	switch setting {
+	case protocolKitty, protocolITerm, protocolSixel:
+		return setting
+	case "none":
+		return ""
+	}
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen") || strings.HasPrefix(term, "tmux"):
+		return ""
+	case term == "xterm-kitty" || term == "xterm-ghostty" || os.Getenv("KITTY_WINDOW_ID") != "":
+		return protocolKitty
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return protocolITerm
+	case strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") || strings.Contains(term, "sixel"):
+		return protocolSixel
+	}
+	return ""
+}
+
+func imagePlaceholder(name string) string {
+	return "[image: " + name + "]"
+}
+
+// imageRefName is the name shown for a reference: its alt text, or the
+// attachment number.
+func imageRefName(alt, id string) string {
+	if strings.TrimSpace(alt) != "" {
+		return alt
+	}
+	return "attachment " + id
+}
+
+// imageLines renders a line that is only an image reference: the image
+// itself where images are drawn inline, and a placeholder otherwise.
+func imageLines(alt, id string, width int) []string {
+	name := imageRefName(alt, id)
+	placeholder := []string{palette.Muted.paint(imagePlaceholder(name))}
+	if imageSource == nil || imageProtocol == "" {
+		return placeholder
+	}
+	n, _ := strconv.Atoi(id)
+	a, err := loadAttachment(imageSource, n)
+	if err != nil || a == nil {
+		return placeholder
+	}
+	seq, err := drawImage(imageProtocol, *a, width, 40)
+	if err != nil {
+		return placeholder
+	}
+	return []string{seq}
+}
+
+// replaceImageRefs swaps the image references in a line of prose for
+// placeholders.
+func replaceImageRefs(line string) string {
+	return imagePattern.ReplaceAllStringFunc(line, func(ref string) string {
+		m := imagePattern.FindStringSubmatch(ref)
+		return imagePlaceholder(imageRefName(m[1], m[2]))
+	})
+}
+
+// imageColumns is how many columns an image of w×h pixels spans: its own
+// size in cells, shrunk to fit maxCols×maxRows.
+func imageColumns(w, h, maxCols, maxRows int) int {
+	cols := min(maxCols, (w+cellWidth-1)/cellWidth)
+	if rows := (cols*cellWidth*h + w*cellHeight - 1) / (w * cellHeight); rows > maxRows {
+		cols = maxRows * cellHeight * w / (h * cellWidth)
+	}
+	return max(cols, 1)
+}
+
+// drawImage returns the escape sequence that draws a at the cursor in at
+// most maxCols×maxRows cells.
+func drawImage(protocol string, a Attachment, maxCols, maxRows int) (string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(a.Data))
+	if err != nil {
+		return "", err
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return "", fmt.Errorf("empty image")
+	}
+	cols := imageColumns(config.Width, config.Height, maxCols, maxRows)
+
+	switch protocol {
+	case protocolITerm:
+		return itermImage(a.Name, a.Data, cols), nil
+	case protocolKitty:
+		data := a.Data
+		if a.Mime != "image/png" {
+			img, _, err := image.Decode(bytes.NewReader(a.Data))
+			if err != nil {
+				return "", err
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				return "", err
+			}
+			data = buf.Bytes()
+		}
+		return kittyImage(data, cols), nil
+	case protocolSixel:
+		img, _, err := image.Decode(bytes.NewReader(a.Data))
+		if err != nil {
+			return "", err
+		}
+		return sixelImage(img, min(cols*cellWidth, config.Width)), nil
+	}
+	return "", fmt.Errorf("unknown image protocol %q", protocol)
+}
+
+// kittyImage draws PNG data over cols columns with the kitty graphics
+// protocol. The payload is sent in chunks of 4096 bytes and q=2 stops the
+// terminal from answering.
+func kittyImage(pngData []byte, cols int) string {
+	const chunkSize = 4096
+	payload := base64.StdEncoding.EncodeToString(pngData)
+	var b strings.Builder
+	for first := true; first || payload != ""; first = false {
+		chunk := payload[:min(chunkSize, len(payload))]
+		payload = payload[len(chunk):]
+		more := 0
+		if payload != "" {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&b, "\033_Ga=T,f=100,q=2,c=%d,m=%d;%s\033\\", cols, more, chunk)
+		} else {
+			fmt.Fprintf(&b, "\033_Gm=%d;%s\033\\", more, chunk)
+		}
+	}
+	return b.String()
+}
+
+// itermImage draws an image file over cols columns with iTerm2's inline
+// image protocol, which WezTerm also understands.
+func itermImage(name string, data []byte, cols int) string {
+	return fmt.Sprintf("\033]1337;File=name=%s;size=%d;width=%d;preserveAspectRatio=1;inline=1:%s\a",
+		base64.StdEncoding.EncodeToString([]byte(name)), len(data), cols,
+		base64.StdEncoding.EncodeToString(data))
+}
+
+// sixelImage scales img to width pixels and encodes it as sixel with a
+// 256-colour palette. Transparent pixels are left unpainted.
+func sixelImage(img image.Image, width int) string {
+	bounds := img.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			scaled.Set(x, y, img.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+	paletted := image.NewPaletted(scaled.Bounds(), colorpalette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, scaled.Bounds(), scaled, image.Point{})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\033P0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range colorpalette.Plan9 {
+		r, g, bl, _ := c.RGBA()
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+	opaque := func(x, y int) bool {
+		_, _, _, a := scaled.At(x, y).RGBA()
+		return a >= 0x8000
+	}
+	for top := 0; top < height; top += 6 {
+		var used []uint8
+		for y := top; y < min(top+6, height); y++ {
+			for x := 0; x < width; x++ {
+				if i := paletted.ColorIndexAt(x, y); opaque(x, y) && !slices.Contains(used, i) {
+					used = append(used, i)
+				}
+			}
+		}
+		for n, i := range used {
+			if n > 0 {
+				b.WriteByte('$')
+			}
+			fmt.Fprintf(&b, "#%d", i)
+			row := make([]byte, width)
+			for x := 0; x < width; x++ {
+				bits := 0
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if paletted.ColorIndexAt(x, top+dy) == i && opaque(x, top+dy) {
+						bits |= 1 << dy
+					}
+				}
+				row[x] = byte(63 + bits)
+			}
+			writeSixelRuns(&b, row)
+		}
+		b.WriteByte('-')
+	}
+	b.WriteString("\033\\")
+	return b.String()
+}
+
+// writeSixelRuns writes sixel data, compressing runs of the same sixel.
+func writeSixelRuns(b *strings.Builder, row []byte) {
+	for x := 0; x < len(row); {
+		run := 1
+		for x+run < len(row) && row[x+run] == row[x] {
+			run++
+		}
+		if run > 3 {
+			fmt.Fprintf(b, "!%d%c", run, row[x])
+		} else {
+			b.Write(bytes.Repeat(row[x:x+1], run))
+		}
+		x += run
+	}
+}
+
+// cardImageRefs lists the attachment ids and names referenced on the
+// current card, the question's first.
+func (m model) cardImageRefs() [][2]string {
+	q := m.questions[m.index]
+	texts := []string{q.Text}
+	if m.showAnswers {
+		texts = append(texts, q.Answers...)
+	}
+	var refs [][2]string
+	for _, text := range texts {
+		for _, match := range imagePattern.FindAllStringSubmatch(text, -1) {
+			refs = append(refs, [2]string{match[2], imageRefName(match[1], match[2])})
+		}
+	}
+	return refs
+}
+
+// imageViewer shows a card's images while the full-screen UI is paused,
+// then waits for Enter. It is run through tea.Exec.
+type imageViewer struct {
+	db       *sql.DB
+	protocol string
+	refs     [][2]string
+	width    int
+	height   int
+	stdin    io.Reader
+	stdout   io.Writer
+}
+
+func (v *imageViewer) SetStdin(r io.Reader)  { v.stdin = r }
+func (v *imageViewer) SetStdout(w io.Writer) { v.stdout = w }
+func (v *imageViewer) SetStderr(io.Writer)   {}
+
+func (v *imageViewer) Run() error {
+	fmt.Fprint(v.stdout, "\033[2J\033[H")
+	for _, ref := range v.refs {
+		fmt.Fprintln(v.stdout, palette.Heading.paint(ref[1]))
+		n, _ := strconv.Atoi(ref[0])
+		a, err := loadAttachment(v.db, n)
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			fmt.Fprintln(v.stdout, palette.Error.paint(fmt.Sprintf("No attachment %d", n)))
+			continue
+		}
+		seq, err := drawImage(v.protocol, *a, v.width, max(v.height-3, 1))
+		if err != nil {
+			fmt.Fprintln(v.stdout, palette.Error.paint(fmt.Sprintf("Cannot show %s: %v", a.Name, err)))
+			continue
+		}
+		fmt.Fprintln(v.stdout, seq)
+	}
+	fmt.Fprint(v.stdout, palette.Muted.paint("Press Enter to return to the cards."))
+	_, err := bufio.NewReader(v.stdin).ReadString('\n')
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// imagesShownMsg reports that the image viewer closed.
+type imagesShownMsg struct{ err error }
+
+// showImages opens the image viewer for the current card, or explains why
+// it cannot.
+func (m model) showImages() (model, tea.Cmd) {
+	refs := m.cardImageRefs()
+	protocol := detectImageProtocol(cfg.Images)
+	switch {
+	case len(refs) == 0:
+		m.notice = "No images on this card"
+	case m.db == nil:
+		m.notice = palette.Error.paint("Images are stored in the database and cannot be shown for -deck")
+	case protocol == "" || noColor:
+		m.notice = palette.Error.paint("This terminal cannot show images (see images in the config)")
+	default:
+		viewer := &imageViewer{db: m.db, protocol: protocol, refs: refs, width: m.width, height: m.height}
+		return m, tea.Exec(viewer, func(err error) tea.Msg { return imagesShownMsg{err} })
+	}
+	return m, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testPNG is a 2×2 image: two red pixels over a blue and a transparent one.
+var testPNG = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x48, 0x44, 0x52,
+	0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x02, 0x08, 0x06, 0x00, 0x00, 0x00, 0x72, 0xb6, 0x0d,
+	0x24, 0x00, 0x00, 0x00, 0x1f, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x00, 0x12, 0x00, 0xed, 0xff,
+	0x04, 0xff, 0x00, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00,
+	0x00, 0x00, 0x03, 0x00, 0x2a, 0x30, 0x04, 0x01, 0x16, 0xce, 0xe1, 0xa5, 0x00, 0x00, 0x00, 0x00,
+	0x49, 0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+func TestKittyImage(t *testing.T) {
+	// 3072 zero bytes encode to exactly one 4096-byte chunk of "A".
+	tests := []struct {
+		name string
+		data []byte
+		cols int
+		want string
+	}{
+		{
+			name: "tiny png",
+			data: testPNG,
+			cols: 1,
+			want: "\033_Ga=T,f=100,q=2,c=1,m=0;" + base64.StdEncoding.EncodeToString(testPNG) + "\033\\",
+		},
+		{
+			name: "exactly one chunk",
+			data: make([]byte, 3072),
+			cols: 20,
+			want: "\033_Ga=T,f=100,q=2,c=20,m=0;" + strings.Repeat("A", 4096) + "\033\\",
+		},
+		{
+			name: "one byte over a chunk",
+			data: make([]byte, 3073),
+			cols: 20,
+			want: "\033_Ga=T,f=100,q=2,c=20,m=1;" + strings.Repeat("A", 4096) + "\033\\" +
+				"\033_Gm=0;AA==\033\\",
+		},
+		{
+			name: "three chunks",
+			data: make([]byte, 3072*2+3),
+			cols: 5,
+			want: "\033_Ga=T,f=100,q=2,c=5,m=1;" + strings.Repeat("A", 4096) + "\033\\" +
+				"\033_Gm=1;" + strings.Repeat("A", 4096) + "\033\\" +
+				"\033_Gm=0;AAAA\033\\",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kittyImage(tt.data, tt.cols); got != tt.want {
+				t.Errorf("kittyImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestITermImage(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		cols int
+		want string
+	}{
+		{
+			name: "tiny png",
+			file: "dot.png",
+			data: testPNG,
+			cols: 3,
+			want: "\033]1337;File=name=ZG90LnBuZw==;size=88;width=3;preserveAspectRatio=1;inline=1:" +
+				base64.StdEncoding.EncodeToString(testPNG) + "\a",
+		},
+		{
+			name: "empty name",
+			file: "",
+			data: []byte("abc"),
+			cols: 40,
+			want: "\033]1337;File=name=;size=3;width=40;preserveAspectRatio=1;inline=1:YWJj\a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itermImage(tt.file, tt.data, tt.cols); got != tt.want {
+				t.Errorf("itermImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSixelImage(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(testPNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sixelImage(img, 2)
+
+	const header = "\033P0;1;0q\"1;1;2;2"
+	if !strings.HasPrefix(got, header) {
+		t.Fatalf("sixelImage() = %q, want header %q", got, header)
+	}
+	if n := len(regexp.MustCompile(`#\d+;2;\d+;\d+;\d+`).FindAllString(got, -1)); n != 256 {
+		t.Errorf("palette has %d colours, want 256", n)
+	}
+	if !strings.Contains(got, "#240;2;100;0;0#") {
+		t.Errorf("palette does not define red as colour 240: %q", got)
+	}
+	// Red (240) fills the top row of both columns; blue (54) the second row
+	// of the first column. The transparent pixel is not painted.
+	const body = "#240@@$#54A?-\033\\"
+	if !strings.HasSuffix(got, body) {
+		t.Errorf("sixelImage() ends in %q, want %q", got[len(got)-len(body):], body)
+	}
+}
+
+func TestWriteSixelRuns(t *testing.T) {
+	tests := []struct {
+		row  string
+		want string
+	}{
+		{"", ""},
+		{"@", "@"},
+		{"???", "???"},
+		{"????", "!4?"},
+		{"@@@@@@@@@@AA~", "!10@AA~"},
+		{"?@?@", "?@?@"},
+		{"~~~~~@@@@", "!5~!4@"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		writeSixelRuns(&b, []byte(tt.row))
+		if got := b.String(); got != tt.want {
+			t.Errorf("writeSixelRuns(%q) = %q, want %q", tt.row, got, tt.want)
+		}
+	}
+}
+
+func TestDetectImageProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		env     map[string]string
+		want    string
+	}{
+		{name: "explicit kitty", setting: "kitty", want: protocolKitty},
+		{name: "explicit iterm", setting: "iterm", want: protocolITerm},
+		{name: "explicit sixel inside tmux", setting: "sixel", env: map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"}, want: protocolSixel},
+		{name: "none", setting: "none", env: map[string]string{"TERM": "xterm-kitty"}, want: ""},
+		{name: "kitty term", setting: "auto", env: map[string]string{"TERM": "xterm-kitty"}, want: protocolKitty},
+		{name: "ghostty", setting: "auto", env: map[string]string{"TERM": "xterm-ghostty"}, want: protocolKitty},
+		{name: "kitty window", setting: "auto", env: map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, want: protocolKitty},
+		{name: "iterm", setting: "auto", env: map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "iTerm.app"}, want: protocolITerm},
+		{name: "wezterm", setting: "auto", env: map[string]string{"TERM_PROGRAM": "WezTerm"}, want: protocolITerm},
+		{name: "iterm over ssh", setting: "auto", env: map[string]string{"LC_TERMINAL": "iTerm2"}, want: protocolITerm},
+		{name: "foot", setting: "auto", env: map[string]string{"TERM": "foot"}, want: protocolSixel},
+		{name: "mlterm", setting: "auto", env: map[string]string{"TERM": "mlterm"}, want: protocolSixel},
+		{name: "sixel term", setting: "auto", env: map[string]string{"TERM": "xterm-sixel"}, want: protocolSixel},
+		{name: "tmux", setting: "auto", env: map[string]string{"TERM": "xterm-kitty", "TMUX": "/tmp/tmux-1000/default,1,0"}, want: ""},
+		{name: "screen", setting: "auto", env: map[string]string{"TERM": "screen-256color", "TERM_PROGRAM": "iTerm.app"}, want: ""},
+		{name: "tmux term", setting: "", env: map[string]string{"TERM": "tmux-256color"}, want: ""},
+		{name: "plain xterm", setting: "auto", env: map[string]string{"TERM": "xterm-256color"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TERM", "TERM_PROGRAM", "TMUX", "KITTY_WINDOW_ID", "LC_TERMINAL"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := detectImageProtocol(tt.setting); got != tt.want {
+				t.Errorf("detectImageProtocol(%q) = %q, want %q", tt.setting, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrawImage(t *testing.T) {
+	a := Attachment{Name: "dot.png", Mime: "image/png", Data: testPNG}
+	tests := []struct {
+		protocol string
+		want     string
+	}{
+		{protocolKitty, kittyImage(testPNG, 1)},
+		{protocolITerm, itermImage("dot.png", testPNG, 1)},
+	}
+	for _, tt := range tests {
+		got, err := drawImage(tt.protocol, a, 80, 40)
+		if err != nil {
+			t.Fatalf("drawImage(%q): %v", tt.protocol, err)
+		}
+		if got != tt.want {
+			t.Errorf("drawImage(%q) = %q, want %q", tt.protocol, got, tt.want)
+		}
+	}
+	if _, err := drawImage("nope", a, 80, 40); err == nil {
+		t.Error("drawImage with an unknown protocol did not fail")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+func runImport(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: fcards import deck.md [more.md ...]")
+	}
+
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		deck, err := parseDeck(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		inserted, updated := 0, 0
+		for _, card := range deck.Cards {
+			_, status, err := saveQuestion(tx, card)
+			if err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			switch status {
+			case saveInserted:
+				inserted++
+			case saveUpdated:
+				updated++
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d new, %d updated, %d unchanged\n",
+			path, inserted, updated, len(deck.Cards)-inserted-updated)
+	}
+	return nil
+}
+
+const (
+	saveUnchanged = iota
+	saveInserted
+	saveUpdated
+)
+
+// saveQuestion writes q to the database. A card is matched to an existing
+// question by its uid, or failing that by identical text and type, so
+// importing the same deck twice never duplicates cards.
+func saveQuestion(tx *sql.Tx, q Question) (int, int, error) {
+	existing, err := findQuestion(tx, q)
+	if err != nil {
+		return 0, saveUnchanged, err
+	}
+
+	if existing == nil {
+		var uid any
+		if q.UID != "" {
+			uid = q.UID
+		}
+		res, err := tx.Exec(`INSERT INTO questions(text, type, uid) VALUES (?, ?, ?);`, q.Text, q.Type, uid)
+		if err != nil {
+			return 0, saveUnchanged, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, saveUnchanged, err
+		}
+		if err := replaceAnswers(tx, int(id), q.Answers); err != nil {
+			return 0, saveUnchanged, err
+		}
+		if err := replaceTags(tx, int(id), q.Tags); err != nil {
+			return 0, saveUnchanged, err
+		}
+		return int(id), saveInserted, nil
+	}
+
+	if q.UID == "" {
+		q.UID = existing.UID
+	}
+	if sameCard(*existing, q) && q.UID == existing.UID {
+		return existing.ID, saveUnchanged, nil
+	}
+	if _, err := tx.Exec(`UPDATE questions SET text = ?, type = ?, uid = ? WHERE id = ?;`,
+		q.Text, q.Type, q.UID, existing.ID); err != nil {
+		return 0, saveUnchanged, err
+	}
+	if err := replaceAnswers(tx, existing.ID, q.Answers); err != nil {
+		return 0, saveUnchanged, err
+	}
+	if err := replaceTags(tx, existing.ID, q.Tags); err != nil {
+		return 0, saveUnchanged, err
+	}
+	return existing.ID, saveUpdated, nil
+}
+
+func findQuestion(tx *sql.Tx, q Question) (*Question, error) {
+	var found Question
+	var err error
+	if q.UID != "" {
+		err = tx.QueryRow(`SELECT id, uid, text, type FROM questions WHERE uid = ?;`, q.UID).
+			Scan(&found.ID, &found.UID, &found.Text, &found.Type)
+		if err == nil {
+			return loadCardInto(tx, &found)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	err = tx.QueryRow(`SELECT id, uid, text, type FROM questions WHERE text = ? AND type = ? ORDER BY id LIMIT 1;`,
+		q.Text, q.Type).Scan(&found.ID, &found.UID, &found.Text, &found.Type)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadCardInto(tx, &found)
+}
+
+func loadCardInto(tx *sql.Tx, q *Question) (*Question, error) {
+	rows, err := tx.Query(`SELECT text FROM answers WHERE question_id = ? ORDER BY id;`, q.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return nil, err
+		}
+		q.Answers = append(q.Answers, text)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := tx.Query(`
+		SELECT t.name FROM question_tags qt JOIN tags t ON t.id = qt.tag_id
+		WHERE qt.question_id = ? ORDER BY t.name;`, q.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var name string
+		if err := tagRows.Scan(&name); err != nil {
+			return nil, err
+		}
+		q.Tags = append(q.Tags, name)
+	}
+	return q, tagRows.Err()
+}
+
+func replaceAnswers(tx *sql.Tx, questionID int, answers []string) error {
+	if _, err := tx.Exec(`DELETE FROM answers WHERE question_id = ?;`, questionID); err != nil {
+		return err
+	}
+	for _, ans := range answers {
+		if _, err := tx.Exec(`INSERT INTO answers(question_id, text) VALUES (?, ?);`, questionID, ans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replaceTags(tx *sql.Tx, questionID int, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM question_tags WHERE question_id = ?;`, questionID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags(name) VALUES (?);`, tag); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO question_tags(question_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?;`, questionID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameCard(a, b Question) bool {
+	return a.Text == b.Text && a.Type == b.Type &&
+		slices.Equal(a.Answers, b.Answers) && slices.Equal(sortedTags(a.Tags), sortedTags(b.Tags))
+}
+
+func sortedTags(tags []string) []string {
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return sorted
+}
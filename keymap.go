@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Keys are named the way bubbletea reports them ("j", "N", "ctrl+n",
+// "alt+<", "enter"), plus "space" for the space bar. A binding made of
+// several space-separated keys, such as "g g", is a sequence that must be
+// typed in order. ctrl+c always quits and cannot be rebound.
+
+const (
+	actQuit        = "quit"
+	actUp          = "up"
+	actDown        = "down"
+	actNext        = "next"
+	actPrev        = "prev"
+	actFlip        = "flip"
+	actFirst       = "first"
+	actLast        = "last"
+	actSearch      = "search"
+	actNextMatch   = "next_match"
+	actPrevMatch   = "prev_match"
+	actOpen        = "open"
+	actExpand      = "expand"
+	actCollapse    = "collapse"
+	actHelp        = "help"
+	actScrollLeft  = "scroll_left"
+	actScrollRight = "scroll_right"
+	actWrap        = "wrap"
+	actSplit       = "split"
+	actFocus       = "focus"
+	actCopy        = "copy"
+	actCopyCode    = "copy_code"
+	actImages      = "images"
+)
+
+var (
+	cardActions  = []string{actFlip, actNext, actPrev, actUp, actDown, actScrollLeft, actScrollRight, actWrap, actSplit, actFocus, actCopy, actCopyCode, actImages, actFirst, actLast, actSearch, actNextMatch, actPrevMatch, actHelp, actQuit}
+	groupActions = []string{actUp, actDown, actOpen, actExpand, actCollapse, actSearch, actHelp, actQuit}
+)
+
+// bindings maps an action to the key sequences that trigger it.
+type bindings map[string][]string
+
+type keyPreset struct {
+	Cards bindings
+	Group bindings
+}
+
+var keyPresets = map[string]keyPreset{
+	"vim": {
+		Cards: bindings{
+			actFlip:        {"enter", "space"},
+			actNext:        {"l", "L"},
+			actPrev:        {"h", "H"},
+			actUp:          {"k", "K", "up"},
+			actDown:        {"j", "J", "down"},
+			actScrollLeft:  {"left", "z h"},
+			actScrollRight: {"right", "z l"},
+			actWrap:        {"w"},
+			actSplit:       {"s"},
+			actFocus:       {"tab"},
+			actCopy:        {"y"},
+			actCopyCode:    {"Y"},
+			actImages:      {"i"},
+			actFirst:       {"g g"},
+			actLast:        {"G"},
+			actSearch:      {"/"},
+			actNextMatch:   {"n"},
+			actPrevMatch:   {"N"},
+			actHelp:        {"?", "f1"},
+			actQuit:        {"q"},
+		},
+		Group: bindings{
+			actUp:       {"k", "K", "up"},
+			actDown:     {"j", "J", "down"},
+			actOpen:     {"enter"},
+			actExpand:   {"l", "L", "right"},
+			actCollapse: {"h", "H", "left"},
+			actSearch:   {"/"},
+			actHelp:     {"?", "f1"},
+			actQuit:     {"q"},
+		},
+	},
+	"arrows": {
+		Cards: bindings{
+			actFlip:        {"enter", "space"},
+			actNext:        {"pgdown"},
+			actPrev:        {"pgup"},
+			actUp:          {"up"},
+			actDown:        {"down"},
+			actScrollLeft:  {"left"},
+			actScrollRight: {"right"},
+			actWrap:        {"f2"},
+			actSplit:       {"f5"},
+			actFocus:       {"f6"},
+			actCopy:        {"f7"},
+			actCopyCode:    {"f8"},
+			actImages:      {"f9"},
+			actFirst:       {"home"},
+			actLast:        {"end"},
+			actSearch:      {"/", "f3"},
+			actNextMatch:   {"tab"},
+			actPrevMatch:   {"shift+tab"},
+			actHelp:        {"?", "f1"},
+			actQuit:        {"esc"},
+		},
+		Group: bindings{
+			actUp:       {"up"},
+			actDown:     {"down"},
+			actOpen:     {"enter"},
+			actExpand:   {"right"},
+			actCollapse: {"left"},
+			actSearch:   {"/", "f3"},
+			actHelp:     {"?", "f1"},
+			actQuit:     {"esc"},
+		},
+	},
+	"emacs": {
+		Cards: bindings{
+			actFlip:        {"enter", "ctrl+t"},
+			actNext:        {"ctrl+f"},
+			actPrev:        {"ctrl+b"},
+			actUp:          {"ctrl+p", "up"},
+			actDown:        {"ctrl+n", "down"},
+			actScrollLeft:  {"left", "ctrl+x <"},
+			actScrollRight: {"right", "ctrl+x >"},
+			actWrap:        {"alt+w"},
+			actSplit:       {"ctrl+x 3"},
+			actFocus:       {"ctrl+x o"},
+			actCopy:        {"ctrl+x y"},
+			actCopyCode:    {"ctrl+x Y"},
+			actImages:      {"ctrl+x i"},
+			actFirst:       {"alt+<"},
+			actLast:        {"alt+>"},
+			actSearch:      {"ctrl+s"},
+			actNextMatch:   {"alt+n"},
+			actPrevMatch:   {"alt+p"},
+			actHelp:        {"?", "f1"},
+			actQuit:        {"ctrl+x k"},
+		},
+		Group: bindings{
+			actUp:       {"ctrl+p", "up"},
+			actDown:     {"ctrl+n", "down"},
+			actOpen:     {"enter"},
+			actExpand:   {"ctrl+f", "right"},
+			actCollapse: {"ctrl+b", "left"},
+			actSearch:   {"ctrl+s"},
+			actHelp:     {"?", "f1"},
+			actQuit:     {"ctrl+x k"},
+		},
+	},
+}
+
+// Keymap is the compiled set of bindings for every mode.
+type Keymap struct {
+	Cards bindings
+	Group bindings
+
+	cards keyIndex
+	group keyIndex
+}
+
+// keyIndex maps a complete sequence to its action. prefixes holds every
+// incomplete sequence, so the UI knows to wait for the next key.
+type keyIndex struct {
+	actions  map[string]string
+	prefixes map[string]bool
+}
+
+// keymap is the active keymap, built from the config in main.
+var keymap, _ = newKeymap(defaultConfig().Keys)
+
+// newKeymap starts from the configured preset and applies per-action
+// overrides on top. Conflicting bindings are reported as errors.
+func newKeymap(c KeysConfig) (*Keymap, error) {
+	preset, ok := keyPresets[c.Preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (use vim, arrows or emacs)", c.Preset)
+	}
+	k := &Keymap{}
+	var err error
+	if k.Cards, err = applyOverrides("cards", cardActions, preset.Cards, c.Cards); err != nil {
+		return nil, err
+	}
+	if k.Group, err = applyOverrides("group", groupActions, preset.Group, c.Group); err != nil {
+		return nil, err
+	}
+	if k.cards, err = compileBindings("cards", cardActions, k.Cards); err != nil {
+		return nil, err
+	}
+	if k.group, err = compileBindings("group", groupActions, k.Group); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func applyOverrides(mode string, actions []string, base, overrides bindings) (bindings, error) {
+	merged := make(bindings, len(base))
+	for action, seqs := range base {
+		merged[action] = seqs
+	}
+	for action, seqs := range overrides {
+		if !slices.Contains(actions, action) {
+			return nil, fmt.Errorf("keys.%s: unknown action %q", mode, action)
+		}
+		merged[action] = seqs
+	}
+	return merged, nil
+}
+
+func compileBindings(mode string, actions []string, b bindings) (keyIndex, error) {
+	index := keyIndex{actions: make(map[string]string), prefixes: make(map[string]bool)}
+	for _, action := range actions {
+		for _, seq := range b[action] {
+			keys := strings.Fields(seq)
+			if len(keys) == 0 {
+				return index, fmt.Errorf("keys.%s.%s: empty binding", mode, action)
+			}
+			seq = strings.Join(keys, " ")
+			// ctrl+c quits before the keymap sees it, so a sequence using
+			// it anywhere could never complete.
+			if slices.Contains(keys, "ctrl+c") {
+				return index, fmt.Errorf("keys.%s.%s: ctrl+c is reserved for quitting", mode, action)
+			}
+			if other, ok := index.actions[seq]; ok && other != action {
+				return index, fmt.Errorf("keys.%s: %q is bound to both %s and %s", mode, seq, other, action)
+			}
+			index.actions[seq] = action
+			for i := 1; i < len(keys); i++ {
+				index.prefixes[strings.Join(keys[:i], " ")] = true
+			}
+		}
+	}
+
+	seqs := make([]string, 0, len(index.actions))
+	for seq := range index.actions {
+		seqs = append(seqs, seq)
+	}
+	sort.Strings(seqs)
+	for _, seq := range seqs {
+		if index.prefixes[seq] {
+			return index, fmt.Errorf("keys.%s: %q (%s) is the start of a longer binding", mode, seq, index.actions[seq])
+		}
+	}
+	return index, nil
+}
+
+func (k *Keymap) index(mode int) keyIndex {
+	if mode == modeGroup {
+		return k.group
+	}
+	return k.cards
+}
+
+// lookup returns the action bound to seq in mode, or whether seq is the
+// start of a longer binding.
+func (k *Keymap) lookup(mode int, seq []string) (action string, pending bool) {
+	index := k.index(mode)
+	joined := strings.Join(seq, " ")
+	if action, ok := index.actions[joined]; ok {
+		return action, false
+	}
+	return "", index.prefixes[joined]
+}
+
+func keyName(msg tea.KeyMsg) string {
+	if msg.Type == tea.KeySpace {
+		return "space"
+	}
+	return msg.String()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileBindings(t *testing.T) {
+	actions := []string{actNext, actPrev, actFirst, actQuit}
+	tests := []struct {
+		name    string
+		b       bindings
+		wantErr string
+	}{
+		{
+			name: "distinct keys and sequences",
+			b:    bindings{actNext: {"l", "space"}, actPrev: {"h"}, actFirst: {"g g"}, actQuit: {"q"}},
+		},
+		{
+			name: "same key twice for one action",
+			b:    bindings{actNext: {"l", "l"}},
+		},
+		{
+			name: "sequences sharing a prefix",
+			b:    bindings{actFirst: {"g g"}, actQuit: {"g q"}},
+		},
+		{
+			name:    "duplicate key",
+			b:       bindings{actNext: {"l"}, actPrev: {"h", "l"}},
+			wantErr: `keys.cards: "l" is bound to both next and prev`,
+		},
+		{
+			name:    "duplicate sequence with extra spaces",
+			b:       bindings{actFirst: {"g g"}, actQuit: {" g  g "}},
+			wantErr: `keys.cards: "g g" is bound to both first and quit`,
+		},
+		{
+			name:    "key is the start of a sequence",
+			b:       bindings{actNext: {"g"}, actFirst: {"g g"}},
+			wantErr: `keys.cards: "g" (next) is the start of a longer binding`,
+		},
+		{
+			name:    "sequence is the start of a longer one",
+			b:       bindings{actFirst: {"z g"}, actQuit: {"z g q"}},
+			wantErr: `keys.cards: "z g" (first) is the start of a longer binding`,
+		},
+		{
+			name:    "ctrl+c alone",
+			b:       bindings{actQuit: {"ctrl+c"}},
+			wantErr: "keys.cards.quit: ctrl+c is reserved for quitting",
+		},
+		{
+			name:    "ctrl+c later in a sequence",
+			b:       bindings{actQuit: {"ctrl+x ctrl+c"}},
+			wantErr: "keys.cards.quit: ctrl+c is reserved for quitting",
+		},
+		{
+			name:    "empty binding",
+			b:       bindings{actNext: {"  "}},
+			wantErr: "keys.cards.next: empty binding",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileBindings("cards", actions, tt.b)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("compileBindings() error = %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("compileBindings() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeymapLookup(t *testing.T) {
+	index, err := compileBindings("cards", cardActions, bindings{actFirst: {"g g"}, actLast: {"G"}, actQuit: {"ctrl+x k"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Keymap{cards: index}
+	tests := []struct {
+		seq         string
+		wantAction  string
+		wantPending bool
+	}{
+		{"g", "", true},
+		{"g g", actFirst, false},
+		{"G", actLast, false},
+		{"ctrl+x", "", true},
+		{"ctrl+x k", actQuit, false},
+		{"ctrl+x g", "", false},
+		{"x", "", false},
+	}
+	for _, tt := range tests {
+		action, pending := k.lookup(modeCards, strings.Fields(tt.seq))
+		if action != tt.wantAction || pending != tt.wantPending {
+			t.Errorf("lookup(%q) = %q, %v, want %q, %v", tt.seq, action, pending, tt.wantAction, tt.wantPending)
+		}
+	}
+}
+
+func TestKeyPresets(t *testing.T) {
+	for name := range keyPresets {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newKeymap(KeysConfig{Preset: name}); err != nil {
+				t.Errorf("preset %s: %v", name, err)
+			}
+		})
+	}
+}
+
+func TestKeymapOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  KeysConfig
+		wantErr string
+	}{
+		{
+			name:   "override replaces the preset binding",
+			config: KeysConfig{Preset: "vim", Cards: bindings{actNext: {"ctrl+n"}}},
+		},
+		{
+			name:    "override clashes with the preset",
+			config:  KeysConfig{Preset: "vim", Cards: bindings{actFlip: {"j"}}},
+			wantErr: `keys.cards: "j" is bound to both`,
+		},
+		{
+			name:    "override starts a preset sequence",
+			config:  KeysConfig{Preset: "vim", Cards: bindings{actFlip: {"g"}}},
+			wantErr: `keys.cards: "g" (flip) is the start of a longer binding`,
+		},
+		{
+			name:    "unknown action",
+			config:  KeysConfig{Preset: "vim", Group: bindings{"jump": {"x"}}},
+			wantErr: `keys.group: unknown action "jump"`,
+		},
+		{
+			name:    "unknown preset",
+			config:  KeysConfig{Preset: "nano"},
+			wantErr: `unknown preset "nano"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newKeymap(tt.config)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("newKeymap() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+				t.Errorf("newKeymap() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
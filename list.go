@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func runList(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var typeFilter string
+	var tagFilter string
+	var notTagFilter string
+	var format string
+	var groupBy string
+	fs.StringVar(&typeFilter, "type", "", "only list questions of this type")
+	fs.StringVar(&tagFilter, "tag", "", "only list questions with all of these comma-separated tags")
+	fs.StringVar(&notTagFilter, "not-tag", "", "skip questions with any of these comma-separated tags")
+	fs.StringVar(&format, "format", "table", "output format (table, json, ids)")
+	fs.StringVar(&groupBy, "group", "", "list groups with their question counts instead (supported: type, tag)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(groupBy) != "" {
+		groupBy = strings.ToLower(strings.TrimSpace(groupBy))
+		if groupBy != "type" && groupBy != "tag" {
+			return fmt.Errorf("unsupported group: %s", groupBy)
+		}
+		groups, err := loadGroups(db, groupBy)
+		if err != nil {
+			return err
+		}
+		return listGroups(groups, groupBy, format)
+	}
+
+	questions, err := loadQuestions(db, questionFilter{
+		Type:        typeFilter,
+		Tags:        splitTags(tagFilter),
+		ExcludeTags: splitTags(notTagFilter),
+	})
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTYPE\tTAGS\tANSWERS\tQUESTION")
+		for _, q := range questions {
+			name := q.Type
+			if strings.TrimSpace(name) == "" {
+				name = "(none)"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\n", q.ID, name, strings.Join(q.Tags, ","), len(q.Answers), firstLine(q.Text))
+		}
+		return tw.Flush()
+	case "json":
+		return writeJSON(os.Stdout, questions)
+	case "ids":
+		for _, q := range questions {
+			fmt.Println(q.ID)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func listGroups(groups []TypeGroup, groupBy, format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(groupBy)+"\tQUESTIONS")
+		for _, g := range groups {
+			name := g.Type
+			if strings.TrimSpace(name) == "" {
+				name = "(none)"
+			}
+			fmt.Fprintf(tw, "%s\t%d\n", name, g.Count)
+		}
+		return tw.Flush()
+	case "json":
+		out := make([]map[string]any, 0, len(groups))
+		for _, g := range groups {
+			out = append(out, map[string]any{groupBy: g.Type, "count": g.Count})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "ids":
+		for _, g := range groups {
+			fmt.Println(g.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func runShow(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	var width int
+	fs.IntVar(&width, "width", 80, "wrap the card to this many columns")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: fcards show ID")
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid id %q", fs.Arg(0))
+	}
+
+	q, err := loadQuestion(db, id)
+	if err != nil {
+		return err
+	}
+	if q == nil {
+		return fmt.Errorf("no question with id %d", id)
+	}
+
+	decks, err := loadDecks(db)
+	if err != nil {
+		return err
+	}
+	deck := resolveDeck(decks, q.Type)
+	if !noColor {
+		imageSource = db
+		imageProtocol = detectImageProtocol(cfg.Images)
+	}
+
+	name := q.Type
+	if strings.TrimSpace(name) == "" {
+		name = "(none)"
+	}
+	fmt.Printf("%s#%d%s  %s", accentColor(deck.Color), q.ID, reset, name)
+	if len(q.Tags) > 0 {
+		fmt.Printf("  [%s]", strings.Join(q.Tags, ", "))
+	}
+	fmt.Println()
+	for _, line := range buildCardContentLines(*q, true, width, deck.CodeLang, false) {
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// loadQuestion returns the question with id and its answers and tags, or
+// nil when there is none.
+func loadQuestion(db *sql.DB, id int) (*Question, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	q := Question{ID: id}
+	err = tx.QueryRow(`SELECT uid, text, type FROM questions WHERE id = ?;`, id).Scan(&q.UID, &q.Text, &q.Type)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadCardInto(tx, &q)
+}
@@ -9,6 +9,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -18,6 +19,8 @@ import (
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
 	_ "modernc.org/sqlite"
 )
 
@@ -26,9 +29,20 @@ var migrationsFS embed.FS
 
 type Question struct {
 	ID      int
+	UID     string
 	Text    string
 	Answers []string
 	Type    string
+	Tags    []string
+}
+
+// questionFilter narrows loadQuestions. Type matches that deck and all of
+// its sub-decks. A question must have every tag in Tags and none of the tags
+// in ExcludeTags.
+type questionFilter struct {
+	Type        string
+	Tags        []string
+	ExcludeTags []string
 }
 
 type TypeGroup struct {
@@ -36,17 +50,22 @@ type TypeGroup struct {
 	Count int
 }
 
-const (
-	orange = "\033[38;5;208m"
-	reset  = "\033[0m"
-)
+// reset ends every coloured span. It is empty when colour is disabled.
+var reset = "\033[0m"
 
+// getDataDir returns ~/.fcards, or $XDG_DATA_HOME/fcards when XDG_DATA_HOME
+// is set and there is no database in ~/.fcards yet.
 func getDataDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 	dir := filepath.Join(home, ".fcards")
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		if _, err := os.Stat(filepath.Join(dir, "flashcards.db")); err != nil {
+			dir = filepath.Join(xdg, "fcards")
+		}
+	}
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", err
 	}
@@ -59,19 +78,127 @@ const (
 )
 
 func main() {
+	cfgPath, err := configPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to find config:", err)
+		os.Exit(1)
+	}
+	cfg, err = loadConfig(cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config %s: %v\n", cfgPath, err)
+		os.Exit(1)
+	}
+	theme, err := resolveTheme(cfg)
+	if err == nil {
+		palette, err = compileTheme(theme)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid theme in %s: %v\n", cfgPath, err)
+		os.Exit(1)
+	}
+	keymap, err = newKeymap(cfg.Keys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid key bindings in %s: %v\n", cfgPath, err)
+		os.Exit(1)
+	}
+
 	var typeFilter string
+	var tagFilter string
+	var notTagFilter string
 	var groupBy string
-	flag.StringVar(&typeFilter, "type", "", "filter questions by type")
-	flag.StringVar(&groupBy, "group", "", "group questions (supported: type)")
+	var deckPath string
+	var dbPath string
+	var profile string
+	var noColorFlag bool
+	flag.StringVar(&typeFilter, "type", cfg.Type, "filter questions by type")
+	flag.StringVar(&tagFilter, "tag", "", "only questions with all of these comma-separated tags")
+	flag.StringVar(&notTagFilter, "not-tag", "", "skip questions with any of these comma-separated tags")
+	flag.StringVar(&groupBy, "group", cfg.Group, "group questions (supported: type, tag)")
+	flag.StringVar(&deckPath, "deck", "", "study a markdown or CSV deck file (- for stdin) without using the database")
+	flag.StringVar(&dbPath, "db", "", "path to the database file (default $FCARDS_DB or ~/.fcards/flashcards.db)")
+	flag.StringVar(&profile, "profile", "", "use the database of this profile")
+	flag.BoolVar(&noColorFlag, "no-color", false, "disable colours and syntax highlighting (also $NO_COLOR)")
+	flag.BoolVar(&plainMode, "plain", false, "study with a line-based prompt instead of the full-screen UI")
 	flag.Parse()
 
+	if noColorFlag || plainMode || !colorSupported() {
+		disableColor()
+	}
+	if plainMode {
+		usePlainGlyphs()
+	}
+
+	cfg.Type = typeFilter
+	cfg.Group = groupBy
+	if profile == "" && os.Getenv("FCARDS_DB") == "" {
+		profile = cfg.Profile
+	}
+	cfg.Profile = profile
+
+	if flag.Arg(0) == "config" {
+		if err := runConfig(cfgPath, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "config:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	filter := questionFilter{
+		Type:        typeFilter,
+		Tags:        splitTags(tagFilter),
+		ExcludeTags: splitTags(notTagFilter),
+	}
+
+	if deckPath != "" {
+		questions, err := loadDeckQuestions(deckPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to read deck:", err)
+			os.Exit(1)
+		}
+		questions = filterQuestions(questions, filter)
+		if len(questions) == 0 {
+			fmt.Fprintln(os.Stderr, "no questions found in deck")
+			os.Exit(1)
+		}
+		questions = prepareSession(questions, resolveDeck(nil, ""))
+		if plainMode && deckPath == "-" {
+			// The deck used up stdin, so answers come from the terminal.
+			tty, err := os.Open("/dev/tty")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "-plain with -deck - needs a terminal to read answers from:", err)
+				os.Exit(1)
+			}
+			defer tty.Close()
+			plainInput = tty
+		}
+		if err := runUI(newCardsModel(questions, nil, nil)); err != nil {
+			fmt.Fprintln(os.Stderr, "ui error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	dataDir, err := getDataDir()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to get data directory:", err)
 		os.Exit(1)
 	}
 
-	db, err := openDB(filepath.Join(dataDir, "flashcards.db"))
+	dbPath, err = resolveDBPath(dataDir, dbPath, profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to resolve database:", err)
+		os.Exit(1)
+	}
+
+	if flag.Arg(0) == "profiles" {
+		if err := runProfiles(dataDir, dbPath); err != nil {
+			fmt.Fprintln(os.Stderr, "profiles:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	db, err := openDB(dbPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to open db:", err)
 		os.Exit(1)
@@ -88,15 +215,30 @@ func main() {
 		os.Exit(1)
 	}
 
+	if flag.NArg() > 0 {
+		if err := runCommand(db, flag.Arg(0), flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	decks, err := loadDecks(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load decks:", err)
+		os.Exit(1)
+	}
+
 	if strings.TrimSpace(groupBy) != "" {
-		switch strings.ToLower(strings.TrimSpace(groupBy)) {
-		case "type":
-			groups, err := loadTypeGroups(db)
+		groupBy = strings.ToLower(strings.TrimSpace(groupBy))
+		switch groupBy {
+		case "type", "tag":
+			groups, err := loadGroups(db, groupBy)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "failed to list questions by type:", err)
+				fmt.Fprintf(os.Stderr, "failed to list questions by %s: %v\n", groupBy, err)
 				os.Exit(1)
 			}
-			if err := runUI(newGroupModel(groups, db)); err != nil {
+			if err := runUI(newGroupModel(groups, groupBy, decks, db)); err != nil {
 				fmt.Fprintln(os.Stderr, "ui error:", err)
 				os.Exit(1)
 			}
@@ -107,7 +249,7 @@ func main() {
 		}
 	}
 
-	questions, err := loadQuestions(db, typeFilter)
+	questions, err := loadQuestions(db, filter)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to load questions:", err)
 		os.Exit(1)
@@ -117,9 +259,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	shuffleQuestions(questions)
+	questions = prepareSession(questions, resolveDeck(decks, typeFilter))
 
-	if err := runUI(newCardsModel(questions)); err != nil {
+	if err := runUI(newCardsModel(questions, decks, db)); err != nil {
 		fmt.Fprintln(os.Stderr, "ui error:", err)
 		os.Exit(1)
 	}
@@ -159,6 +301,9 @@ func runMigrations(db *sql.DB) error {
 			files = append(files, name)
 		}
 	}
+	for name := range goMigrations {
+		files = append(files, name)
+	}
 	sort.Strings(files)
 
 	applied := make(map[string]bool)
@@ -182,19 +327,26 @@ func runMigrations(db *sql.DB) error {
 		if applied[name] {
 			continue
 		}
-		body, err := migrationsFS.ReadFile(filepath.Join("migrations", name))
-		if err != nil {
-			return err
-		}
-		if strings.TrimSpace(string(body)) == "" {
-			continue
+		step, ok := goMigrations[name]
+		if !ok {
+			body, err := migrationsFS.ReadFile(filepath.Join("migrations", name))
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(string(body)) == "" {
+				continue
+			}
+			step = func(tx *sql.Tx) error {
+				_, err := tx.Exec(string(body))
+				return err
+			}
 		}
 
 		tx, err := db.Begin()
 		if err != nil {
 			return err
 		}
-		if _, err := tx.Exec(string(body)); err != nil {
+		if err := step(tx); err != nil {
 			_ = tx.Rollback()
 			return err
 		}
@@ -211,11 +363,19 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
-	return ensureQuestionTypeColumn(db)
+	return nil
+}
+
+// goMigrations are the migration steps that need Go rather than SQL. They
+// are versioned, ordered and recorded alongside the files in migrations.
+var goMigrations = map[string]func(*sql.Tx) error{
+	"001b_question_type_column": ensureQuestionTypeColumn,
 }
 
-func ensureQuestionTypeColumn(db *sql.DB) error {
-	rows, err := db.Query(`PRAGMA table_info(questions);`)
+// ensureQuestionTypeColumn adds the type column to databases created
+// before 001 had it; later migrations read it.
+func ensureQuestionTypeColumn(tx *sql.Tx) error {
+	rows, err := tx.Query(`PRAGMA table_info(questions);`)
 	if err != nil {
 		return err
 	}
@@ -232,14 +392,15 @@ func ensureQuestionTypeColumn(db *sql.DB) error {
 			return err
 		}
 		if name == "type" {
-			return rows.Err()
+			return rows.Close()
 		}
 	}
 	if err := rows.Err(); err != nil {
 		return err
 	}
+	rows.Close()
 
-	_, err = db.Exec(`ALTER TABLE questions ADD COLUMN type TEXT NOT NULL DEFAULT '';`)
+	_, err = tx.Exec(`ALTER TABLE questions ADD COLUMN type TEXT NOT NULL DEFAULT '';`)
 	return err
 }
 
@@ -301,19 +462,34 @@ func seedIfEmpty(db *sql.DB) error {
 	return tx.Commit()
 }
 
-func loadQuestions(db *sql.DB, typeFilter string) ([]Question, error) {
-	baseQuery := `
-		SELECT q.id, q.text, q.type, a.text
+func loadQuestions(db *sql.DB, filter questionFilter) ([]Question, error) {
+	query := `
+		SELECT q.id, q.uid, q.text, q.type, a.text
 		FROM questions q
 		LEFT JOIN answers a ON q.id = a.question_id
 	`
-	var rows *sql.Rows
-	var err error
-	if strings.TrimSpace(typeFilter) != "" {
-		rows, err = db.Query(baseQuery+` WHERE q.type = ? ORDER BY q.id, a.id;`, typeFilter)
-	} else {
-		rows, err = db.Query(baseQuery + ` ORDER BY q.id, a.id;`)
+	var where []string
+	var args []any
+	if strings.TrimSpace(filter.Type) != "" {
+		where = append(where, `(q.type = ? OR substr(q.type, 1, length(?) + 2) = ? || '`+deckSeparator+`')`)
+		args = append(args, filter.Type, filter.Type, filter.Type)
+	}
+	const hasTag = `EXISTS (
+		SELECT 1 FROM question_tags qt JOIN tags t ON t.id = qt.tag_id
+		WHERE qt.question_id = q.id AND t.name = ?)`
+	for _, tag := range filter.Tags {
+		where = append(where, hasTag)
+		args = append(args, tag)
+	}
+	for _, tag := range filter.ExcludeTags {
+		where = append(where, `NOT `+hasTag)
+		args = append(args, tag)
 	}
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	rows, err := db.Query(query+` ORDER BY q.id, a.id;`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -323,15 +499,16 @@ func loadQuestions(db *sql.DB, typeFilter string) ([]Question, error) {
 	var order []int
 	for rows.Next() {
 		var id int
+		var uid string
 		var qText string
 		var qType string
 		var aText sql.NullString
-		if err := rows.Scan(&id, &qText, &qType, &aText); err != nil {
+		if err := rows.Scan(&id, &uid, &qText, &qType, &aText); err != nil {
 			return nil, err
 		}
 		entry, ok := byID[id]
 		if !ok {
-			entry = &Question{ID: id, Text: qText, Type: qType}
+			entry = &Question{ID: id, UID: uid, Text: qText, Type: qType}
 			byID[id] = entry
 			order = append(order, id)
 		}
@@ -343,6 +520,10 @@ func loadQuestions(db *sql.DB, typeFilter string) ([]Question, error) {
 		return nil, err
 	}
 
+	if err := loadTagsInto(db, byID); err != nil {
+		return nil, err
+	}
+
 	questions := make([]Question, 0, len(order))
 	for _, id := range order {
 		questions = append(questions, *byID[id])
@@ -350,6 +531,77 @@ func loadQuestions(db *sql.DB, typeFilter string) ([]Question, error) {
 	return questions, nil
 }
 
+func loadTagsInto(db *sql.DB, byID map[int]*Question) error {
+	rows, err := db.Query(`
+		SELECT qt.question_id, t.name
+		FROM question_tags qt
+		JOIN tags t ON t.id = qt.tag_id
+		ORDER BY t.name;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		if entry, ok := byID[id]; ok {
+			entry.Tags = append(entry.Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// filterQuestions applies filter in memory, for questions that did not come
+// from the database.
+func filterQuestions(questions []Question, filter questionFilter) []Question {
+	filtered := make([]Question, 0, len(questions))
+	for _, q := range questions {
+		if strings.TrimSpace(filter.Type) != "" && !typeMatches(q.Type, filter.Type) {
+			continue
+		}
+		if !hasAllTags(q.Tags, filter.Tags) || hasAnyTag(q.Tags, filter.ExcludeTags) {
+			continue
+		}
+		filtered = append(filtered, q)
+	}
+	return filtered
+}
+
+func hasAllTags(tags, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(tags, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyTag(tags, unwanted []string) bool {
+	for _, u := range unwanted {
+		if slices.Contains(tags, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTags parses a comma-separated tag list such as "go, concurrency".
+func splitTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 func shuffleQuestions(questions []Question) {
 	if len(questions) < 2 {
 		return
@@ -360,13 +612,34 @@ func shuffleQuestions(questions []Question) {
 	})
 }
 
+func loadGroups(db *sql.DB, groupBy string) ([]TypeGroup, error) {
+	if groupBy == "tag" {
+		return loadTagGroups(db)
+	}
+	return loadTypeGroups(db)
+}
+
 func loadTypeGroups(db *sql.DB) ([]TypeGroup, error) {
-	rows, err := db.Query(`
+	return queryGroups(db, `
 		SELECT q.type, COUNT(1)
 		FROM questions q
 		GROUP BY q.type
 		ORDER BY q.type;
 	`)
+}
+
+func loadTagGroups(db *sql.DB) ([]TypeGroup, error) {
+	return queryGroups(db, `
+		SELECT t.name, COUNT(qt.question_id)
+		FROM tags t
+		JOIN question_tags qt ON qt.tag_id = t.id
+		GROUP BY t.name
+		ORDER BY t.name;
+	`)
+}
+
+func queryGroups(db *sql.DB, query string) ([]TypeGroup, error) {
+	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -374,12 +647,12 @@ func loadTypeGroups(db *sql.DB) ([]TypeGroup, error) {
 
 	var groups []TypeGroup
 	for rows.Next() {
-		var qType string
+		var name string
 		var count int
-		if err := rows.Scan(&qType, &count); err != nil {
+		if err := rows.Scan(&name, &count); err != nil {
 			return nil, err
 		}
-		groups = append(groups, TypeGroup{Type: qType, Count: count})
+		groups = append(groups, TypeGroup{Type: name, Count: count})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -387,7 +660,10 @@ func loadTypeGroups(db *sql.DB) ([]TypeGroup, error) {
 	return groups, nil
 }
 
-func runUI(m tea.Model) error {
+func runUI(m model) error {
+	if plainMode {
+		return runPlain(plainInput, os.Stdout, m)
+	}
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	_, err := p.Run()
 	return err
@@ -399,30 +675,58 @@ type model struct {
 	index        int
 	showAnswers  bool
 	scrollOffset int
+	hScroll      int
+	softWrap     bool
+	split        bool
+	focus        int
+	answerScroll int
 	width        int
 	height       int
 	groups       []TypeGroup
+	groupBy      string
 	groupIndex   int
+	expanded     map[string]bool
+	decks        map[string]deckSettings
 	groupQuery   string
 	groupSearch  bool
+	cardQuery    string
+	cardSearch   bool
+	matches      []int
+	matchIndex   int
+	pendingKeys  []string
+	confirmQuit  bool
+	copyPending  bool
+	copyDigits   string
+	notice       string
+	showHelp     bool
+	helpScroll   int
 	db           *sql.DB
 	err          error
 }
 
-func newCardsModel(questions []Question) model {
+func newCardsModel(questions []Question, decks map[string]deckSettings, db *sql.DB) model {
 	return model{
 		mode:      modeCards,
 		questions: questions,
+		decks:     decks,
 		width:     64,
+		softWrap:  cfg.SoftWrap,
+		split:     true,
+		db:        db,
 	}
 }
 
-func newGroupModel(groups []TypeGroup, db *sql.DB) model {
+func newGroupModel(groups []TypeGroup, groupBy string, decks map[string]deckSettings, db *sql.DB) model {
 	return model{
-		mode:   modeGroup,
-		groups: groups,
-		width:  64,
-		db:     db,
+		mode:     modeGroup,
+		groups:   groups,
+		groupBy:  groupBy,
+		expanded: make(map[string]bool),
+		decks:    decks,
+		width:    64,
+		softWrap: cfg.SoftWrap,
+		split:    true,
+		db:       db,
 	}
 }
 
@@ -431,20 +735,54 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	if next.index != m.index || next.width != m.width || next.mode != m.mode {
+		cmd = tea.Batch(cmd, next.precomputeNext())
+	}
+	return next, cmd
+}
+
+func (m model) update(msg tea.Msg) (model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case copiedMsg:
+		if msg.err != nil {
+			m.notice = palette.Error.paint("Cannot copy: " + msg.err.Error())
+		}
+	case imagesShownMsg:
+		if msg.err != nil {
+			m.notice = palette.Error.paint("Cannot show images: " + msg.err.Error())
+		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		if m.mode == modeCards && m.index < len(m.questions) {
-			maxScroll := cardMaxScroll(m.questions[m.index], m.showAnswers, m.width, m.height)
-			m.scrollOffset = clampScroll(m.scrollOffset, maxScroll)
-		}
+		m = m.clampScrolls()
 	case tea.KeyMsg:
-		if m.mode == modeGroup && m.groupSearch {
-			if msg.String() == "ctrl+c" || msg.String() == "q" {
+		if m.showHelp {
+			if msg.Type == tea.KeyCtrlC {
 				return m, tea.Quit
 			}
+			_, entries := m.helpEntries()
+			switch action, _ := keymap.lookup(m.mode, []string{keyName(msg)}); action {
+			case actUp:
+				m.helpScroll = max(m.helpScroll-1, 0)
+			case actDown:
+				m.helpScroll = min(m.helpScroll+1, helpMaxScroll(entries, m.helpWidth(), m.height))
+			default:
+				m.showHelp = false
+			}
+			return m, nil
+		}
+		if (m.groupSearch || m.cardSearch) && msg.Type != tea.KeyRunes && msg.Type != tea.KeySpace {
+			if action, _ := keymap.lookup(m.mode, []string{keyName(msg)}); action == actHelp {
+				m.showHelp = true
+				m.helpScroll = 0
+				return m, nil
+			}
+		}
+		if m.mode == modeGroup && m.groupSearch {
 			switch msg.Type {
+			case tea.KeyCtrlC:
+				return m, tea.Quit
 			case tea.KeyEsc:
 				m.groupSearch = false
 			case tea.KeyEnter:
@@ -456,73 +794,234 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		}
-		switch msg.String() {
-		case "ctrl+c", "q":
+		if m.mode == modeCards && m.cardSearch {
+			switch msg.Type {
+			case tea.KeyCtrlC:
+				return m, tea.Quit
+			case tea.KeyEsc:
+				m.cardSearch = false
+				m.cardQuery = ""
+			case tea.KeyEnter:
+				m.cardSearch = false
+				matches, err := findMatches(m.db, m.questions, m.cardQuery)
+				if err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.matches = matches
+				m.matchIndex = 0
+				if len(matches) > 0 {
+					m = m.jumpTo(matches[0])
+				}
+			case tea.KeyBackspace, tea.KeyCtrlH:
+				m.cardQuery = dropLastRune(m.cardQuery)
+			case tea.KeyRunes, tea.KeySpace:
+				m.cardQuery += string(msg.Runes)
+			}
+			return m, nil
+		}
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		m.notice = ""
+		if m.copyPending {
+			return m.copyCodeKey(msg)
+		}
+		var action string
+		m, action = m.resolveKey(msg)
+		if m.confirmQuit {
+			m.confirmQuit = false
+			if action == actQuit || keyName(msg) == "y" || keyName(msg) == "Y" {
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		switch action {
+		case actQuit:
+			if cfg.Keys.ConfirmQuit && m.mode == modeCards && m.err == nil && m.index < len(m.questions) {
+				m.confirmQuit = true
+				return m, nil
+			}
 			return m, tea.Quit
-		case "up", "k", "K":
+		case actNextMatch, actPrevMatch:
+			if m.mode == modeCards && len(m.matches) > 0 {
+				step := 1
+				if action == actPrevMatch {
+					step = len(m.matches) - 1
+				}
+				m.matchIndex = (m.matchIndex + step) % len(m.matches)
+				m = m.jumpTo(m.matches[m.matchIndex])
+			}
+		case actHelp:
+			m.showHelp = true
+			m.helpScroll = 0
+		case actFirst:
+			if m.mode == modeCards && len(m.questions) > 0 {
+				m = m.jumpTo(0)
+			}
+		case actLast:
+			if m.mode == modeCards && len(m.questions) > 0 {
+				m = m.jumpTo(len(m.questions) - 1)
+			}
+		case actUp:
 			if m.mode == modeCards && m.index < len(m.questions) {
-				if m.scrollOffset > 0 {
-					m.scrollOffset--
+				if scroll := m.scrollTarget(); *scroll > 0 {
+					*scroll--
 				}
 			} else if m.mode == modeGroup && m.groupIndex > 0 {
 				m.groupIndex--
 			}
-		case "down", "j", "J":
+		case actDown:
 			if m.mode == modeCards && m.index < len(m.questions) {
-				maxScroll := cardMaxScroll(m.questions[m.index], m.showAnswers, m.width, m.height)
-				if m.scrollOffset < maxScroll {
-					m.scrollOffset++
+				if scroll := m.scrollTarget(); *scroll < m.maxScroll() {
+					*scroll++
 				}
 			} else if m.mode == modeGroup {
-				filtered := filterGroups(m.groups, m.groupQuery)
-				if m.groupIndex < len(filtered)-1 {
+				rows := m.groupRows()
+				if m.groupIndex < len(rows)-1 {
 					m.groupIndex++
 				}
 			}
-		case "/":
+		case actSearch:
 			if m.mode == modeGroup {
 				m.groupSearch = true
 				m.groupQuery = ""
+			} else if m.mode == modeCards {
+				m.cardSearch = true
+				m.cardQuery = ""
+				m.matches = nil
 			}
-		case "enter":
-			if m.mode == modeGroup {
-				filtered := filterGroups(m.groups, m.groupQuery)
-				if m.groupIndex >= 0 && m.groupIndex < len(filtered) {
-					selected := filtered[m.groupIndex].Type
-					questions, err := loadQuestions(m.db, selected)
-					if err != nil {
-						m.err = err
-						return m, nil
-					}
-					shuffleQuestions(questions)
-					m.mode = modeCards
-					m.questions = questions
-					m.index = 0
-					m.showAnswers = false
-					m.scrollOffset = 0
+		case actOpen:
+			rows := m.groupRows()
+			if m.groupIndex >= 0 && m.groupIndex < len(rows) {
+				selected := rows[m.groupIndex].Path
+				filter := questionFilter{Type: selected}
+				if m.groupBy == "tag" {
+					filter = questionFilter{Tags: []string{selected}}
+				}
+				questions, err := loadQuestions(m.db, filter)
+				if err != nil {
+					m.err = err
+					return m, nil
+				}
+				deck := resolveDeck(nil, "")
+				if m.groupBy == "type" {
+					deck = resolveDeck(m.decks, selected)
 				}
-			} else if m.index < len(m.questions) {
+				questions = prepareSession(questions, deck)
+				m.mode = modeCards
+				m.questions = questions
+				m.index = 0
+				m.showAnswers = false
+				m.scrollOffset = 0
+				m.hScroll = 0
+				m.answerScroll = 0
+				m.focus = paneQuestion
+			}
+		case actFlip:
+			if m.index < len(m.questions) {
 				m.showAnswers = !m.showAnswers
 				m.scrollOffset = 0
+				m.hScroll = 0
+				m.answerScroll = 0
+				m.focus = paneQuestion
+				if m.showAnswers && m.splitView() {
+					m.focus = paneAnswers
+				}
 			}
-		case "l", "L":
-			if m.mode == modeCards && m.index < len(m.questions) {
+		case actScrollLeft, actScrollRight:
+			if m.index >= len(m.questions) {
+				break
+			}
+			maxH := m.maxHScroll()
+			if maxH == 0 {
+				// Nothing to scroll sideways: behave like prev/next.
+				if action == actScrollRight {
+					m.index++
+				} else if m.index > 0 {
+					m.index--
+				} else {
+					break
+				}
+				m.showAnswers = false
+				m.scrollOffset = 0
+				m.hScroll = 0
+				m.answerScroll = 0
+				m.focus = paneQuestion
+				break
+			}
+			if action == actScrollRight {
+				m.hScroll = min(m.hScroll+hScrollStep, maxH)
+			} else {
+				m.hScroll = max(m.hScroll-hScrollStep, 0)
+			}
+		case actWrap:
+			m.softWrap = !m.softWrap
+			m.hScroll = 0
+			m = m.clampScrolls()
+		case actSplit:
+			m.split = !m.split
+			m.hScroll = 0
+			m = m.clampScrolls()
+		case actFocus:
+			if m.splitView() {
+				m.focus = 1 - m.focus
+			}
+		case actCopy:
+			if m.index < len(m.questions) {
+				return m.copyAnswers()
+			}
+		case actImages:
+			if m.index < len(m.questions) {
+				return m.showImages()
+			}
+		case actCopyCode:
+			if m.index >= len(m.questions) {
+				break
+			}
+			if len(m.cardCodeBlocks()) == 0 {
+				m.notice = palette.Error.paint("No code blocks on this card")
+				break
+			}
+			m.copyPending = true
+		case actNext:
+			if m.index < len(m.questions) {
 				m.index++
 				m.showAnswers = false
 				m.scrollOffset = 0
+				m.hScroll = 0
+				m.answerScroll = 0
+				m.focus = paneQuestion
 			}
-		case "h", "H":
-			if m.mode == modeCards && m.index > 0 {
+		case actPrev:
+			if m.index > 0 {
 				m.index--
 				m.showAnswers = false
 				m.scrollOffset = 0
+				m.hScroll = 0
+				m.answerScroll = 0
+				m.focus = paneQuestion
+			}
+		case actExpand:
+			rows := m.groupRows()
+			if m.groupIndex < len(rows) && rows[m.groupIndex].HasChildren {
+				m.expanded[rows[m.groupIndex].Path] = true
+			}
+		case actCollapse:
+			rows := m.groupRows()
+			if m.groupIndex < len(rows) {
+				if rows[m.groupIndex].Expanded && m.groupQuery == "" {
+					delete(m.expanded, rows[m.groupIndex].Path)
+				} else if parent := parentRow(rows, m.groupIndex); parent >= 0 {
+					m.groupIndex = parent
+				}
 			}
 		}
 	}
 	if m.mode == modeGroup {
-		filtered := filterGroups(m.groups, m.groupQuery)
-		if m.groupIndex >= len(filtered) {
-			m.groupIndex = len(filtered) - 1
+		rows := m.groupRows()
+		if m.groupIndex >= len(rows) {
+			m.groupIndex = len(rows) - 1
 		}
 		if m.groupIndex < 0 {
 			m.groupIndex = 0
@@ -531,35 +1030,203 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// resolveKey feeds a key press into the keymap. It returns the action once
+// a whole binding has been typed; keys that start a longer binding are held
+// in pendingKeys until the sequence completes or breaks.
+func (m model) resolveKey(msg tea.KeyMsg) (model, string) {
+	seq := append(slices.Clone(m.pendingKeys), keyName(msg))
+	action, pending := keymap.lookup(m.mode, seq)
+	switch {
+	case action != "":
+		m.pendingKeys = nil
+	case pending:
+		m.pendingKeys = seq
+	case len(m.pendingKeys) > 0:
+		m.pendingKeys = nil
+		return m.resolveKey(msg)
+	}
+	return m, action
+}
+
+// maxHScroll is how far the current card can scroll sideways.
+func (m model) maxHScroll() int {
+	if m.mode != modeCards || m.index >= len(m.questions) {
+		return 0
+	}
+	q := m.questions[m.index]
+	if m.splitView() {
+		return splitMaxHScroll(q, m.cardDeck(q), m.showAnswers, m.softWrap, m.width)
+	}
+	return cardMaxHScroll(q, m.cardDeck(q), m.showAnswers, m.softWrap, m.width)
+}
+
+// scrollTarget is the scroll offset that up/down move: the whole card, or
+// the focused pane in the split layout.
+func (m *model) scrollTarget() *int {
+	if m.splitView() && m.focus == paneAnswers {
+		return &m.answerScroll
+	}
+	return &m.scrollOffset
+}
+
+// maxScroll is the largest value of *scrollTarget() for the current card.
+func (m model) maxScroll() int {
+	if m.mode != modeCards || m.index >= len(m.questions) {
+		return 0
+	}
+	q := m.questions[m.index]
+	deck := m.cardDeck(q)
+	if m.splitView() {
+		return splitMaxScroll(q, deck, m.showAnswers, m.softWrap, m.focus, m.width, m.viewHeight())
+	}
+	return cardMaxScroll(q, deck, m.showAnswers, m.softWrap, m.width, m.viewHeight())
+}
+
+// clampScrolls keeps every scroll offset in range after the card, the
+// layout or the terminal size changed.
+func (m model) clampScrolls() model {
+	if m.mode != modeCards || m.index >= len(m.questions) {
+		return m
+	}
+	focus := m.focus
+	m.focus = paneQuestion
+	m.scrollOffset = clampScroll(m.scrollOffset, m.maxScroll())
+	m.focus = paneAnswers
+	m.answerScroll = clampScroll(m.answerScroll, m.maxScroll())
+	m.focus = focus
+	m.hScroll = clampScroll(m.hScroll, m.maxHScroll())
+	return m
+}
+
+// viewHeight is the height left for the card once the status line under
+// it is drawn.
+func (m model) viewHeight() int {
+	if m.searchStatus() != "" && m.height > 0 {
+		return m.height - 1
+	}
+	return m.height
+}
+
+func (m model) groupRows() []groupRow {
+	rows := groupRows(m.groups, m.groupBy == "type", m.expanded, m.groupQuery)
+	if m.groupBy == "type" {
+		for i := range rows {
+			if d, ok := m.decks[rows[i].Path]; ok {
+				rows[i].Description = d.Description
+			}
+		}
+	}
+	return rows
+}
+
+func (m model) cardDeck(q Question) Deck {
+	return resolveDeck(m.decks, q.Type)
+}
+
+func (m model) jumpTo(index int) model {
+	if index != m.index {
+		m.index = index
+		m.showAnswers = false
+		m.scrollOffset = 0
+		m.hScroll = 0
+		m.answerScroll = 0
+		m.focus = paneQuestion
+	}
+	return m
+}
+
 func (m model) View() string {
+	if m.showHelp {
+		return m.helpView()
+	}
 	if m.err != nil {
-		return padToHeight(fmt.Sprintf("Error: %v\nq to quit\n", m.err), m.height)
+		return padToHeight(palette.Error.paint(fmt.Sprintf("Error: %v", m.err))+"\n"+keymap.hints(m.mode, hint{"quit", []string{actQuit}})+"\n", m.height)
 	}
 	if m.mode == modeGroup {
-		view := renderGroupList(m.groups, m.groupIndex, m.width, m.height, m.groupQuery, m.groupSearch) + "\n"
+		view := renderGroupList(m.groupRows(), m.groupBy, m.groupIndex, m.width, m.height, m.groupQuery, m.groupSearch) + "\n"
 		return padToHeight(view, m.height)
 	}
 	if m.index >= len(m.questions) {
-		return padToHeight(orange+"No more questions in this session."+reset+"\nq to quit\n", m.height)
+		return padToHeight(accentColor("")+"No more questions in this session."+reset+"\n"+keymap.hints(modeCards, hint{"back", []string{actPrev}}, hint{"quit", []string{actQuit}})+"\n", m.height)
 	}
 
 	width := cardWidth(m.width)
 
 	q := m.questions[m.index]
-	maxScroll := cardMaxScroll(q, m.showAnswers, m.width, m.height)
-	m.scrollOffset = clampScroll(m.scrollOffset, maxScroll)
-	view := renderCard(q, m.showAnswers, m.index+1, len(m.questions), width, m.height, m.scrollOffset) + "\n"
+	deck := m.cardDeck(q)
+	m = m.clampScrolls()
+	height := m.viewHeight()
+	status := m.searchStatus()
+	var view string
+	if m.splitView() {
+		view = m.renderSplit(q, deck, height) + "\n"
+	} else {
+		view = renderCard(q, deck, m.showAnswers, m.index+1, len(m.questions), width, height, m.scrollOffset, m.hScroll, m.softWrap) + "\n"
+	}
+	if status != "" {
+		view += status + "\n"
+	}
 	return padToHeight(view, m.height)
 }
 
-func renderCard(q Question, showAnswers bool, pos, total, width, height, scrollOffset int) string {
+func (m model) helpView() string {
+	title, entries := m.helpEntries()
+	return renderHelp(m.mode, title, entries, m.helpWidth(), m.height, m.helpScroll)
+}
+
+// helpEntries is the help for whatever has the keyboard.
+func (m model) helpEntries() (string, []helpEntry) {
+	switch {
+	case m.cardSearch || m.groupSearch:
+		return "search", searchHelp
+	case m.mode == modeGroup:
+		return "group " + m.groupBy, keymap.help(modeGroup)
+	default:
+		return "cards", keymap.help(modeCards)
+	}
+}
+
+// helpWidth is the width of the help box: the whole terminal, up to a
+// comfortable reading width.
+func (m model) helpWidth() int {
+	if m.width <= 0 {
+		return cardWidth(m.width)
+	}
+	return max(min(m.width, 100), 20)
+}
+
+func (m model) searchStatus() string {
+	switch {
+	case m.confirmQuit:
+		return "Quit this session? (y/n)"
+	case m.cardSearch:
+		return "Search: " + m.cardQuery
+	case m.copyPending:
+		return fmt.Sprintf("Copy code block (1-%d): %s", len(m.cardCodeBlocks()), m.copyDigits)
+	case m.notice != "":
+		return m.notice
+	case m.cardQuery == "":
+		return ""
+	case len(m.matches) == 0:
+		return palette.Error.paint(fmt.Sprintf("No matches for %q", m.cardQuery))
+	default:
+		status := fmt.Sprintf("Match %d/%d for %q", m.matchIndex+1, len(m.matches), m.cardQuery)
+		if hints := keymap.hints(modeCards, hint{"next/prev match", []string{actNextMatch, actPrevMatch}}); hints != "" {
+			status += "  •  " + hints
+		}
+		return status
+	}
+}
+
+func renderCard(q Question, deck Deck, showAnswers bool, pos, total, width, height, scrollOffset, hScroll int, wrap bool) string {
 	inner := width - 2
+	accent := accentColor(deck.Color)
 
 	line := func(text string) string {
-		return orange + "|" + reset + " " + padRight(text, inner-2) + " " + orange + "|" + reset
+		return accent + "|" + reset + " " + padRight(text, inner-2) + " " + accent + "|" + reset
 	}
 
-	contentLines := buildCardContentLines(q, showAnswers, inner-2)
+	contentLines := buildCardContentLines(q, showAnswers, inner-2, deck.CodeLang, wrap)
 	visibleLines := visibleContentLines(len(contentLines), height)
 	maxScroll := max(0, len(contentLines)-visibleLines)
 	scrollOffset = clampScroll(scrollOffset, maxScroll)
@@ -569,50 +1236,50 @@ func renderCard(q Question, showAnswers bool, pos, total, width, height, scrollO
 		end = len(contentLines)
 	}
 
-	controls := "Enter: flip  •  H/L: next card"
-	if showAnswers {
-		controls = "H/L: next card  •  Enter: flip"
-	}
+	hints := []hint{{"flip", []string{actFlip}}, {"prev/next", []string{actPrev, actNext}}, {"help", []string{actHelp}}}
 	if len(contentLines) > visibleLines {
-		controls = "Up/Down: scroll  •  " + controls
+		hints = append(hints, hint{"scroll", []string{actUp, actDown}})
+	}
+	if maxLineWidth(contentLines) > inner-2 {
+		hints = append(hints, hint{"pan", []string{actScrollLeft, actScrollRight}}, hint{"wrap", []string{actWrap}})
 	}
+	controls := keymap.fitHints(modeCards, inner-2, hints...)
 
 	builder := strings.Builder{}
-	builder.WriteString(orange)
+	builder.WriteString(accent)
 	builder.WriteString("+" + strings.Repeat("-", inner) + "+\n")
 	builder.WriteString(line(fmt.Sprintf("fcards%*s", inner-8, fmt.Sprintf("%d/%d", pos, total))) + "\n")
-	builder.WriteString(orange)
+	builder.WriteString(accent)
 	builder.WriteString("+" + strings.Repeat("-", inner) + "+\n")
 	builder.WriteString(reset)
 
 	for _, lineText := range contentLines[start:end] {
-		builder.WriteString(line(lineText) + "\n")
+		builder.WriteString(line(clipColumns(lineText, hScroll, inner-2)) + "\n")
 	}
-	builder.WriteString(line(controls) + "\n")
+	builder.WriteString(line(palette.Muted.paint(controls)) + "\n")
 
-	builder.WriteString(orange)
+	builder.WriteString(accent)
 	builder.WriteString("+" + strings.Repeat("-", inner) + "+")
 	builder.WriteString(reset)
 
 	return builder.String()
 }
 
-func renderGroupList(groups []TypeGroup, selected, width, height int, query string, searching bool) string {
+func renderGroupList(rows []groupRow, groupBy string, selected, width, height int, query string, searching bool) string {
 	_ = width
 	builder := strings.Builder{}
-	builder.WriteString(orange)
-	builder.WriteString("fcards — group by type")
+	builder.WriteString(accentColor(""))
+	builder.WriteString("fcards — group by " + groupBy)
 	builder.WriteString(reset)
 	builder.WriteString("\n\n")
 
-	filtered := filterGroups(groups, query)
 	if searching || strings.TrimSpace(query) != "" {
 		builder.WriteString("Search: " + query + "\n\n")
 	}
 
-	if len(filtered) == 0 {
-		builder.WriteString("No types found.\n")
-		builder.WriteString("q to quit\n")
+	if len(rows) == 0 {
+		builder.WriteString("No " + groupBy + "s found.\n")
+		builder.WriteString(keymap.hints(modeGroup, hint{"quit", []string{actQuit}}) + "\n")
 		return builder.String()
 	}
 
@@ -625,21 +1292,39 @@ func renderGroupList(groups []TypeGroup, selected, width, height int, query stri
 		start = selected - maxLines + 1
 	}
 	end := start + maxLines
-	if end > len(filtered) {
-		end = len(filtered)
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	hierarchical := false
+	for _, row := range rows {
+		if row.HasChildren || row.Depth > 0 {
+			hierarchical = true
+			break
+		}
 	}
 
 	for i := start; i < end; i++ {
-		g := filtered[i]
-		name := strings.TrimSpace(g.Type)
+		row := rows[i]
+		name := strings.TrimSpace(row.Name)
 		if name == "" {
 			name = "(none)"
 		}
-		line := fmt.Sprintf("%s - %d", name, g.Count)
+		line := fmt.Sprintf("%s - %d", name, row.Count)
+		if row.Description != "" {
+			line += "  " + row.Description
+		}
+		if hierarchical {
+			marker := "  "
+			if row.Expanded {
+				marker = "▾ "
+			} else if row.HasChildren {
+				marker = "▸ "
+			}
+			line = strings.Repeat("  ", row.Depth) + marker + line
+		}
 		if i == selected {
-			builder.WriteString(orange)
-			builder.WriteString("> " + line)
-			builder.WriteString(reset)
+			builder.WriteString(palette.Selection.paint("> " + line))
 		} else {
 			builder.WriteString("  " + line)
 		}
@@ -647,9 +1332,18 @@ func renderGroupList(groups []TypeGroup, selected, width, height int, query stri
 	}
 	builder.WriteString("\n")
 	if searching {
-		builder.WriteString("Type to search  •  Enter/Esc: done  •  q: quit")
+		builder.WriteString(palette.Muted.paint("Type to search  •  enter/esc: done  •  ctrl+c: quit"))
 	} else {
-		builder.WriteString("J/K: move  •  Enter: open  •  /: search  •  q: quit")
+		hints := []hint{{"move", []string{actUp, actDown}}}
+		if hierarchical {
+			hints = append(hints, hint{"collapse/expand", []string{actCollapse, actExpand}})
+		}
+		hints = append(hints,
+			hint{"open", []string{actOpen}},
+			hint{"search", []string{actSearch}},
+			hint{"help", []string{actHelp}},
+			hint{"quit", []string{actQuit}})
+		builder.WriteString(palette.Muted.paint(keymap.hints(modeGroup, hints...)))
 	}
 	return builder.String()
 }
@@ -687,19 +1381,40 @@ func wrapLines(text string, width int) []string {
 	lines := []string{}
 	var current strings.Builder
 
+	currentWidth := 0
+
 	for _, word := range words {
-		if current.Len() == 0 {
+		wordWidth := visualWidth(word)
+		// Break words wider than a line, e.g. CJK text without spaces.
+		for wordWidth > width && width > 0 {
+			if currentWidth > 0 {
+				lines = append(lines, current.String())
+				current.Reset()
+				currentWidth = 0
+			}
+			head, tail := splitAtWidth(word, width)
+			if tail == "" || visualWidth(head) == 0 {
+				break
+			}
+			lines = append(lines, head)
+			word = tail
+			wordWidth = visualWidth(word)
+		}
+		if currentWidth == 0 {
 			current.WriteString(word)
+			currentWidth = wordWidth
 			continue
 		}
-		if current.Len()+1+len(word) > width {
+		if currentWidth+1+wordWidth > width {
 			lines = append(lines, current.String())
 			current.Reset()
 			current.WriteString(word)
+			currentWidth = wordWidth
 			continue
 		}
 		current.WriteString(" ")
 		current.WriteString(word)
+		currentWidth += 1 + wordWidth
 	}
 	if current.Len() > 0 {
 		lines = append(lines, current.String())
@@ -710,27 +1425,118 @@ func wrapLines(text string, width int) []string {
 	return lines
 }
 
-func formatAnswerLines(answer string, width int) []string {
+// hScrollStep is how many columns one sideways scroll moves.
+const hScrollStep = 4
+
+// continuationMarker starts every line that soft wrapping carried over.
+func continuationMarker() string {
+	return palette.Muted.paint("↪") + " "
+}
+
+// softWrapLines breaks lines wider than width, starting each continuation
+// with a marker. Colours active at a break are carried onto the next line.
+func softWrapLines(lines []string, width int) []string {
+	marker := continuationMarker()
+	markerWidth := visualWidth(marker)
+	if width <= markerWidth {
+		return lines
+	}
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if visualWidth(line) <= width {
+			out = append(out, line)
+			continue
+		}
+		head, tail := splitAtWidth(line, width)
+		out = append(out, head+reset)
+		consumed := head
+		for tail != "" && visualWidth(tail) > 0 {
+			head, tail = splitAtWidth(tail, width-markerWidth)
+			if head == "" {
+				break
+			}
+			out = append(out, marker+activeEscapes(consumed)+head+reset)
+			consumed += head
+		}
+	}
+	return out
+}
+
+// clipColumns returns the part of text from column offset on, at most
+// width columns wide. A line that still does not fit ends in a › marker.
+func clipColumns(text string, offset, width int) string {
+	total := visualWidth(text)
+	if offset > 0 {
+		head, tail := splitAtWidth(text, offset)
+		text = activeEscapes(head) + tail
+	}
+	if total-offset > width && width > 1 {
+		text = truncateToVisualWidth(text, width-1) + reset + palette.Muted.paint("›")
+	}
+	return text
+}
+
+// activeEscapes returns the escape sequences still in effect at the end of
+// text: every sequence after its last full reset.
+func activeEscapes(text string) string {
+	var active strings.Builder
+	forEachSegment(text, func(segment string, escape bool) bool {
+		switch {
+		case !escape:
+		case segment == reset || segment == "\033[m":
+			active.Reset()
+		default:
+			active.WriteString(segment)
+		}
+		return true
+	})
+	return active.String()
+}
+
+func formatAnswerLines(answer string, width int, defaultLang string) []string {
 	const firstPrefix = "- "
 	const nextPrefix = "  "
+
+	out := []string{}
+	used := false
+	for _, line := range renderBody(answer, width-len(firstPrefix), defaultLang) {
+		switch {
+		case !used && line == "":
+			continue
+		case !used:
+			out = append(out, firstPrefix+line)
+			used = true
+		case line == "":
+			out = append(out, "")
+		default:
+			out = append(out, nextPrefix+line)
+		}
+	}
+	return out
+}
+
+// renderBody renders the markdown of a question or answer. Fenced code is
+// highlighted and keeps its indentation; everything else goes through
+// markdownLine.
+func renderBody(text string, width int, defaultLang string) []string {
 	const fence = "```"
 
-	lines := strings.Split(answer, "\n")
 	out := []string{}
 	inCode := false
-	used := false
-	var codeLang string
+	var codeInfo string
 	var codeLines []string
+	flushCode := func() {
+		out = append(out, renderCodeBlock(strings.Join(codeLines, "\n"), codeInfo, defaultLang, width)...)
+	}
 
-	for _, raw := range lines {
+	for _, raw := range strings.Split(text, "\n") {
 		line := strings.TrimRight(raw, "\r")
 		trimmed := strings.TrimSpace(line)
 
-		// Check for opening fence with optional language
+		// Check for opening fence with optional language and marked lines
 		if strings.HasPrefix(trimmed, fence) && !inCode {
 			inCode = true
-			codeLang = strings.TrimPrefix(trimmed, fence)
-			codeLang = strings.TrimSpace(codeLang)
+			codeInfo = strings.TrimPrefix(trimmed, fence)
 			codeLines = []string{}
 			continue
 		}
@@ -738,20 +1544,7 @@ func formatAnswerLines(answer string, width int) []string {
 		// Check for closing fence
 		if strings.HasPrefix(trimmed, fence) && inCode {
 			inCode = false
-			// Highlight the collected code block
-			code := strings.Join(codeLines, "\n")
-			code = expandTabs(code, 4)
-			highlighted := highlightCode(code, codeLang)
-			highlightedLines := strings.Split(strings.TrimSuffix(highlighted, "\n"), "\n")
-
-			for _, hl := range highlightedLines {
-				prefix := nextPrefix
-				if !used {
-					prefix = firstPrefix
-					used = true
-				}
-				out = append(out, prefix+hl)
-			}
+			flushCode()
 			continue
 		}
 
@@ -759,53 +1552,49 @@ func formatAnswerLines(answer string, width int) []string {
 			codeLines = append(codeLines, line)
 			continue
 		}
-
-		if strings.TrimSpace(line) == "" {
-			if used {
-				out = append(out, "")
-			}
+		if m := imagePattern.FindStringSubmatch(trimmed); m != nil && m[0] == trimmed {
+			out = append(out, imageLines(m[1], m[2], width)...)
 			continue
 		}
-
-		prefix := nextPrefix
-		if !used {
-			prefix = firstPrefix
-		}
-		space := width - len(prefix)
-		if space < 1 {
-			space = 1
-		}
-		wrapped := wrapLines(line, space)
-		for i, w := range wrapped {
-			p := nextPrefix
-			if !used && i == 0 {
-				p = firstPrefix
-				used = true
-			}
-			out = append(out, p+w)
-		}
+		out = append(out, markdownLine(replaceImageRefs(line), width)...)
+	}
+	// An unclosed fence runs to the end of the text.
+	if inCode {
+		flushCode()
 	}
-
 	return out
 }
 
-func buildCardContentLines(q Question, showAnswers bool, width int) []string {
-	lines := []string{"QUESTION"}
-	lines = append(lines, wrapLines(q.Text, width)...)
+// buildCardContentLines renders the card body. Lines that are too wide,
+// such as long lines of code, are soft-wrapped when wrap is set and left
+// for the caller to clip otherwise.
+func buildCardContentLines(q Question, showAnswers bool, width int, codeLang string, wrap bool) []string {
+	key := renderKey{"card", cardCacheKey(q), showAnswers, width, codeLang, wrap}
+	return cardLines.lines(key, func() []string {
+		return renderCardContent(q, showAnswers, width, codeLang, wrap)
+	})
+}
+
+func renderCardContent(q Question, showAnswers bool, width int, codeLang string, wrap bool) []string {
+	lines := []string{palette.Heading.paint("QUESTION")}
+	lines = append(lines, renderBody(strings.Trim(q.Text, "\r\n"), width, codeLang)...)
 	lines = append(lines, "")
 
 	if showAnswers {
-		lines = append(lines, "ANSWERS")
+		lines = append(lines, palette.Heading.paint("ANSWERS"))
 		if len(q.Answers) == 0 {
-			lines = append(lines, "(no answers stored)")
+			lines = append(lines, palette.Muted.paint("(no answers stored)"))
 		} else {
 			for _, ans := range q.Answers {
-				lines = append(lines, formatAnswerLines(ans, width)...)
+				lines = append(lines, formatAnswerLines(ans, width, codeLang)...)
 			}
 		}
 		lines = append(lines, "")
 	}
 
+	if wrap {
+		lines = softWrapLines(lines, width)
+	}
 	return lines
 }
 
@@ -828,19 +1617,24 @@ func visibleContentLines(total, height int) int {
 
 func cardWidth(termWidth int) int {
 	width := 64
-	if termWidth > 0 {
+	if cfg.CardWidth > 0 {
+		width = cfg.CardWidth
+	} else if termWidth > 0 {
 		width = termWidth / 2
 	}
-	if width < 34 {
-		width = 34
+	if width < cfg.CardMinWidth {
+		width = cfg.CardMinWidth
+	}
+	if termWidth > 0 && width > termWidth {
+		width = max(termWidth, 10)
 	}
 	return width
 }
 
-func cardMaxScroll(q Question, showAnswers bool, termWidth, termHeight int) int {
+func cardMaxScroll(q Question, deck Deck, showAnswers, wrap bool, termWidth, termHeight int) int {
 	width := cardWidth(termWidth)
 	inner := width - 2
-	contentLines := buildCardContentLines(q, showAnswers, inner-2)
+	contentLines := buildCardContentLines(q, showAnswers, inner-2, deck.CodeLang, wrap)
 	visible := visibleContentLines(len(contentLines), termHeight)
 	if visible == 0 || len(contentLines) <= visible {
 		return 0
@@ -848,6 +1642,25 @@ func cardMaxScroll(q Question, showAnswers bool, termWidth, termHeight int) int
 	return len(contentLines) - visible
 }
 
+// cardMaxHScroll is how many columns the widest line of a card sticks out
+// past the card.
+func cardMaxHScroll(q Question, deck Deck, showAnswers, wrap bool, termWidth int) int {
+	if wrap {
+		return 0
+	}
+	inner := cardWidth(termWidth) - 2
+	contentLines := buildCardContentLines(q, showAnswers, inner-2, deck.CodeLang, false)
+	return max(0, maxLineWidth(contentLines)-(inner-2))
+}
+
+func maxLineWidth(lines []string) int {
+	widest := 0
+	for _, line := range lines {
+		widest = max(widest, visualWidth(line))
+	}
+	return widest
+}
+
 func clampScroll(offset, max int) int {
 	if offset < 0 {
 		return 0
@@ -882,16 +1695,13 @@ func max(a, b int) int {
 }
 
 func highlightCode(code, lang string) string {
-	lexer := lexers.Get(lang)
-	if lexer == nil {
-		lexer = lexers.Analyse(code)
-	}
+	lexer := codeLexer(code, lang)
 	if lexer == nil {
 		lexer = lexers.Fallback
 	}
 	lexer = chroma.Coalesce(lexer)
 
-	style := styles.Get("monokai")
+	style := styles.Get(palette.ChromaStyle)
 	if style == nil {
 		style = styles.Fallback
 	}
@@ -932,59 +1742,105 @@ func expandTabs(s string, tabWidth int) string {
 		}
 		b.WriteRune(r)
 		col++
+		if r == '\n' {
+			col = 0
+		}
 	}
 	return b.String()
 }
 
 func padRight(text string, width int) string {
 	visWidth := visualWidth(text)
-	if visWidth >= width {
-		return truncateToVisualWidth(text, width)
+	if visWidth > width {
+		text = truncateToVisualWidth(text, width)
+		visWidth = visualWidth(text)
 	}
-	return text + strings.Repeat(" ", width-visWidth)
+	return text + strings.Repeat(" ", max(0, width-visWidth))
 }
 
+// visualWidth returns the number of terminal columns text occupies,
+// ignoring escape sequences. Wide characters (CJK, most emoji) take two
+// columns and combining marks none.
 func visualWidth(text string) int {
-	inEscape := false
 	width := 0
-	for _, r := range text {
-		if r == '\033' {
-			inEscape = true
-			continue
+	forEachSegment(text, func(segment string, escape bool) bool {
+		if !escape {
+			width += runewidth.StringWidth(segment)
 		}
-		if inEscape {
-			if r == 'm' {
-				inEscape = false
+		return true
+	})
+	return width
+}
+
+// truncateToVisualWidth cuts text to at most maxWidth columns without
+// splitting a grapheme cluster. Escape sequences are kept, including those
+// after the cut, so styles are still switched off.
+func truncateToVisualWidth(text string, maxWidth int) string {
+	head, tail := splitAtWidth(text, maxWidth)
+	forEachSegment(tail, func(segment string, escape bool) bool {
+		if escape {
+			head += segment
+		}
+		return true
+	})
+	return head
+}
+
+// splitAtWidth splits text after at most width columns, on a grapheme
+// boundary. Escape sequences before the cut stay with the head.
+func splitAtWidth(text string, width int) (string, string) {
+	var head strings.Builder
+	used := 0
+	cut := -1
+	offset := 0
+	forEachSegment(text, func(segment string, escape bool) bool {
+		if escape {
+			head.WriteString(segment)
+			offset += len(segment)
+			return true
+		}
+		g := uniseg.NewGraphemes(segment)
+		for g.Next() {
+			cluster := g.Str()
+			w := runewidth.StringWidth(cluster)
+			if used+w > width {
+				cut = offset
+				return false
 			}
-			continue
+			head.WriteString(cluster)
+			used += w
+			offset += len(cluster)
 		}
-		width++
+		return true
+	})
+	if cut < 0 {
+		return head.String(), ""
 	}
-	return width
+	return head.String(), text[cut:]
 }
 
-func truncateToVisualWidth(text string, maxWidth int) string {
-	inEscape := false
-	width := 0
-	var result strings.Builder
-	for _, r := range text {
-		if r == '\033' {
-			inEscape = true
-			result.WriteRune(r)
-			continue
+// forEachSegment calls fn with the runs of plain text and the escape
+// sequences of text, in order, until fn returns false.
+func forEachSegment(text string, fn func(segment string, escape bool) bool) {
+	for text != "" {
+		i := strings.IndexByte(text, '\033')
+		if i < 0 {
+			fn(text, false)
+			return
 		}
-		if inEscape {
-			result.WriteRune(r)
-			if r == 'm' {
-				inEscape = false
+		if i > 0 {
+			if !fn(text[:i], false) {
+				return
 			}
-			continue
+			text = text[i:]
 		}
-		if width >= maxWidth {
-			break
+		end := strings.IndexByte(text, 'm')
+		if end < 0 {
+			end = len(text) - 1
+		}
+		if !fn(text[:end+1], true) {
+			return
 		}
-		result.WriteRune(r)
-		width++
+		text = text[end+1:]
 	}
-	return result.String()
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	eAcute       = "e\u0301"                                                    // e + combining acute accent
+	coder        = "\U0001F469\u200d\U0001F4BB"                                 // woman technologist, a ZWJ sequence
+	family       = "\U0001F468\u200d\U0001F469\u200d\U0001F467\u200d\U0001F466" // four people joined by ZWJ
+	sgrRed       = "\033[31m"
+	sgrDefaultFg = "\033[39m"
+	sgrBold      = "\033[1m"
+	sgrBoldOff   = "\033[22m"
+)
+
+func TestVisualWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"ascii", "abc", 3},
+		{"cjk", "日本語", 6},
+		{"halfwidth katakana", "ｱｲ", 2},
+		{"zwj sequence", coder, 2},
+		{"long zwj sequence", family + "x", 3},
+		{"combining marks", eAcute + eAcute + "x", 3},
+		{"devanagari cluster", "क्षि", 2},
+		{"styled", sgrBold + "日本" + sgrBoldOff, 4},
+		{"only escapes", sgrRed + sgrDefaultFg, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visualWidth(tt.in); got != tt.want {
+				t.Errorf("visualWidth(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitAtWidth(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		width    int
+		wantHead string
+		wantTail string
+	}{
+		{"ascii", "abc", 2, "ab", "c"},
+		{"fits", "abc", 3, "abc", ""},
+		{"cjk on a boundary", "日本語", 2, "日", "本語"},
+		{"cjk across a boundary", "日本語", 3, "日", "本語"},
+		{"cjk wider than the cut", "日本語", 1, "", "日本語"},
+		{"zwj sequence kept whole", coder + "ab", 1, "", coder + "ab"},
+		{"zwj sequence fits", family + "x", 2, family, "x"},
+		{"combining mark stays with its letter", eAcute + eAcute + "x", 1, eAcute, eAcute + "x"},
+		{"escape before the cut", sgrBold + "日本" + sgrBoldOff, 2, sgrBold + "日", "本" + sgrBoldOff},
+		{"escape at the cut", sgrRed + "ab" + sgrDefaultFg + "cd", 2, sgrRed + "ab" + sgrDefaultFg, "cd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head, tail := splitAtWidth(tt.in, tt.width)
+			if head != tt.wantHead || tail != tt.wantTail {
+				t.Errorf("splitAtWidth(%q, %d) = %q, %q, want %q, %q", tt.in, tt.width, head, tail, tt.wantHead, tt.wantTail)
+			}
+		})
+	}
+}
+
+func TestSoftWrapLines(t *testing.T) {
+	marker := continuationMarker()
+	tests := []struct {
+		name  string
+		in    []string
+		width int
+		want  []string
+	}{
+		{"short lines untouched", []string{"short", ""}, 5, []string{"short", ""}},
+		{"cjk", []string{"日本語のテキスト"}, 6, []string{
+			"日本語" + reset,
+			marker + "のテ" + reset,
+			marker + "キス" + reset,
+			marker + "ト" + reset,
+		}},
+		{"zwj sequence at the edge", []string{"ab" + coder + "cd"}, 5, []string{
+			"ab" + coder + "c" + reset,
+			marker + "d" + reset,
+		}},
+		{"combining marks", []string{eAcute + eAcute + eAcute + eAcute + eAcute + eAcute + eAcute}, 5, []string{
+			eAcute + eAcute + eAcute + eAcute + eAcute + reset,
+			marker + eAcute + eAcute + reset,
+		}},
+		{"style carried over", []string{sgrBold + "bold text here" + sgrBoldOff}, 6, []string{
+			sgrBold + "bold t" + reset,
+			marker + sgrBold + "ext " + reset,
+			marker + sgrBold + "here" + sgrBoldOff + reset,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := softWrapLines(tt.in, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("softWrapLines(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipColumns(t *testing.T) {
+	more := reset + palette.Muted.paint("›")
+	tests := []struct {
+		name   string
+		in     string
+		offset int
+		width  int
+		want   string
+	}{
+		{"fits", "日本語", 0, 6, "日本語"},
+		{"cjk clipped", "日本語のテキスト", 0, 6, "日本" + more},
+		{"cjk scrolled", "日本語のテキスト", 2, 6, "本語" + more},
+		{"offset inside a wide rune keeps it", "日本語のテキスト", 1, 6, "日本" + more},
+		{"zwj sequence", "x" + family + "yz", 1, 3, family + more},
+		{"combining marks", eAcute + eAcute + eAcute, 1, 5, eAcute + eAcute},
+		{"style before the offset", sgrRed + "red" + sgrDefaultFg + " plain", 2, 4, sgrRed + "d" + sgrDefaultFg + " p" + more},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clipColumns(tt.in, tt.offset, tt.width); got != tt.want {
+				t.Errorf("clipColumns(%q, %d, %d) = %q, want %q", tt.in, tt.offset, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		width int
+		want  []string
+	}{
+		{"words", "one two three", 7, []string{"one two", "three"}},
+		{"cjk without spaces", "日本語のテキストです", 6, []string{"日本語", "のテキ", "ストで", "す"}},
+		{"zwj sequences", "a " + coder + coder + coder + " b", 4, []string{"a", coder + coder, coder + " b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapLines(tt.in, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrapLines(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+			}
+		})
+	}
+}
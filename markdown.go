@@ -0,0 +1,290 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Cards are written in markdown. Block elements are handled line by line
+// (a line break in the source is a line break on the card) and inline
+// markup is turned into SGR escapes. Every style is switched off with its
+// own code rather than a full reset, so the card's accent colour survives.
+
+type sgrStyle struct {
+	on  string
+	off string
+}
+
+var (
+	styleBold      = sgrStyle{"\033[1m", "\033[22m"}
+	styleItalic    = sgrStyle{"\033[3m", "\033[23m"}
+	styleUnderline = sgrStyle{"\033[4m", "\033[24m"}
+)
+
+// inlineStyles are the styles inline markup can leave open at a line
+// break. Inline code takes its colours from the theme.
+func inlineStyles() []sgrStyle {
+	return []sgrStyle{styleBold, styleItalic, styleUnderline, palette.Code}
+}
+
+// Symbols drawn in place of markdown syntax. Plain mode swaps them for
+// ASCII.
+var (
+	glyphRule   = "─"
+	glyphBullet = "•"
+	glyphQuote  = "│"
+)
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern    = regexp.MustCompile(`^\s*(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	quotePattern   = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	listPattern    = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+)
+
+// markdownLine renders one line of markdown prose into lines of at most
+// width columns.
+func markdownLine(line string, width int) []string {
+	if strings.TrimSpace(line) == "" {
+		return []string{""}
+	}
+	if rulePattern.MatchString(line) {
+		return []string{strings.Repeat(glyphRule, max(width, 1))}
+	}
+	if m := headingPattern.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+		lines := wrapStyled(m[2], width)
+		for i := range lines {
+			if len(m[1]) == 1 {
+				lines[i] = styleUnderline.paint(lines[i])
+			}
+			lines[i] = palette.Heading.paint(lines[i])
+		}
+		return lines
+	}
+	if m := quotePattern.FindStringSubmatch(line); m != nil {
+		var out []string
+		for _, l := range markdownLine(m[1], width-2) {
+			out = append(out, palette.Muted.paint(glyphQuote)+" "+l)
+		}
+		return out
+	}
+	if m := listPattern.FindStringSubmatch(line); m != nil {
+		indent := strings.Repeat(" ", len(strings.ReplaceAll(m[1], "\t", "    "))/2*2)
+		marker := m[2]
+		if marker == "-" || marker == "*" || marker == "+" {
+			marker = glyphBullet
+		}
+		first := indent + marker + " "
+		hanging := strings.Repeat(" ", visualWidth(first))
+		wrapped := wrapStyled(m[3], width-len(hanging))
+		for i := range wrapped {
+			if i == 0 {
+				wrapped[i] = first + wrapped[i]
+			} else {
+				wrapped[i] = hanging + wrapped[i]
+			}
+		}
+		return wrapped
+	}
+	// Keep the indentation of plain lines, wrapping under it.
+	expanded := expandTabs(line, 4)
+	indent := len(expanded) - len(strings.TrimLeft(expanded, " "))
+	if indent == 0 || indent > width/2 {
+		return wrapStyled(line, width)
+	}
+	pad := strings.Repeat(" ", indent)
+	wrapped := wrapStyled(line, width-indent)
+	for i := range wrapped {
+		wrapped[i] = pad + wrapped[i]
+	}
+	return wrapped
+}
+
+// wrapStyled renders inline markup and wraps the result, re-opening any
+// style that was still active at the end of the previous line.
+func wrapStyled(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	lines := wrapLines(renderInline(text), width)
+	var open []sgrStyle
+	for i, line := range lines {
+		var prefix strings.Builder
+		for _, s := range open {
+			prefix.WriteString(s.on)
+		}
+		open = activeStyles(open, line)
+		var suffix strings.Builder
+		for j := len(open) - 1; j >= 0; j-- {
+			suffix.WriteString(open[j].off)
+		}
+		lines[i] = prefix.String() + line + suffix.String()
+	}
+	return lines
+}
+
+// activeStyles returns the styles still switched on after line, given the
+// ones that were on before it.
+func activeStyles(open []sgrStyle, line string) []sgrStyle {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\033' {
+			continue
+		}
+		end := strings.IndexByte(line[i:], 'm')
+		if end < 0 {
+			break
+		}
+		code := line[i : i+end+1]
+		for _, s := range inlineStyles() {
+			if s.on == "" {
+				continue
+			}
+			switch code {
+			case s.on:
+				open = append(open, s)
+			case s.off:
+				for j := len(open) - 1; j >= 0; j-- {
+					if open[j] == s {
+						open = append(open[:j:j], open[j+1:]...)
+						break
+					}
+				}
+			}
+		}
+		i += end
+	}
+	return open
+}
+
+// renderInline converts **bold**, *italic* and `code` spans into SGR
+// escapes. A marker without a closing partner is kept as literal text, and
+// a backslash escapes the next character.
+func renderInline(text string) string {
+	runes := []rune(text)
+	var out strings.Builder
+	var open []sgrStyle
+	toggle := func(s sgrStyle) {
+		for j := len(open) - 1; j >= 0; j-- {
+			if open[j] == s {
+				open = append(open[:j:j], open[j+1:]...)
+				out.WriteString(s.off)
+				return
+			}
+		}
+		open = append(open, s)
+		out.WriteString(s.on)
+	}
+	isOpen := func(s sgrStyle) bool {
+		for _, o := range open {
+			if o == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(markdownEscapable, runes[i+1]):
+			out.WriteRune(runes[i+1])
+			i++
+		case r == '`':
+			n := runLength(runes, i, '`')
+			marker := strings.Repeat("`", n)
+			rest := string(runes[i+n:])
+			end := strings.Index(rest, marker)
+			if end < 0 {
+				out.WriteString(marker)
+				i += n - 1
+				continue
+			}
+			code := rest[:end]
+			if strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && strings.TrimSpace(code) != "" {
+				code = code[1 : len(code)-1]
+			}
+			out.WriteString(palette.Code.paint(code))
+			i += n + len([]rune(rest[:end])) + n - 1
+		case r == '*' || r == '_':
+			n := runLength(runes, i, r)
+			style := styleItalic
+			if n >= 2 {
+				n = 2
+				style = styleBold
+			}
+			// A run of three closing both styles closes the inner one first.
+			if n == 2 && runLength(runes, i, r) >= 3 && len(open) > 0 && open[len(open)-1] == styleItalic {
+				n = 1
+				style = styleItalic
+			}
+			prev, next := ' ', ' '
+			if i > 0 {
+				prev = runes[i-1]
+			}
+			if i+n < len(runes) {
+				next = runes[i+n]
+			}
+			marker := strings.Repeat(string(r), n)
+			closing := isOpen(style) && !unicode.IsSpace(prev)
+			opening := !isOpen(style) && !unicode.IsSpace(next) && hasCloser(runes, i+n, r, n)
+			if r == '_' {
+				// Intraword underscores, as in snake_case, are not markup.
+				closing = closing && !isWordRune(next)
+				opening = opening && !isWordRune(prev)
+			}
+			if closing || opening {
+				toggle(style)
+			} else {
+				out.WriteString(marker)
+			}
+			i += n - 1
+		default:
+			out.WriteRune(r)
+		}
+	}
+	for j := len(open) - 1; j >= 0; j-- {
+		out.WriteString(open[j].off)
+	}
+	return out.String()
+}
+
+// hasCloser reports whether a run of n markers r after start can close
+// emphasis: it is not preceded by a space and, for underscores, not
+// followed by a letter or digit. A run of three closes either style.
+// Escaped markers do not count.
+func hasCloser(runes []rune, start int, r rune, n int) bool {
+	for j := start; j < len(runes); j++ {
+		switch runes[j] {
+		case '\\':
+			j++
+		case r:
+			run := runLength(runes, j, r)
+			fits := n == 1 && run != 2 || n == 2 && run >= 2
+			flanked := j > start && !unicode.IsSpace(runes[j-1])
+			if r == '_' && j+run < len(runes) && isWordRune(runes[j+run]) {
+				flanked = false
+			}
+			if fits && flanked {
+				return true
+			}
+			j += run - 1
+		}
+	}
+	return false
+}
+
+// markdownEscapable lists the characters a backslash can escape.
+const markdownEscapable = "\\`*_{}[]()#+-.!>|~"
+
+func runLength(runes []rune, start int, r rune) int {
+	n := 0
+	for start+n < len(runes) && runes[start+n] == r {
+		n++
+	}
+	return n
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
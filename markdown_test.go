@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderInline(t *testing.T) {
+	bold := styleBold.paint
+	italic := styleItalic.paint
+	code := palette.Code.paint
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "no markup here", "no markup here"},
+		{"bold", "a **bold** word", "a " + bold("bold") + " word"},
+		{"italic", "an *italic* word", "an " + italic("italic") + " word"},
+		{"underscores", "__b__ and _i_", bold("b") + " and " + italic("i")},
+		{"italic inside bold", "**bold *and italic* inside**", bold("bold " + italic("and italic") + " inside")},
+		{"bold inside italic", "*italic **bold** inside*", italic("italic " + bold("bold") + " inside")},
+		{"bold and italic at once", "***both***", bold(italic("both"))},
+		{"unclosed bold", "**unclosed", "**unclosed"},
+		{"unclosed italic", "*unclosed", "*unclosed"},
+		{"closed then unclosed", "**a** b **c", bold("a") + " b **c"},
+		{"unclosed italic inside bold", "**open *nested**", bold("open *nested")},
+		{"spaced asterisks", "2 * 3 * 4", "2 * 3 * 4"},
+		{"globs", "match *.go and *.md files", "match *.go and *.md files"},
+		{"trailing glob", "rm -rf *.tmp *", "rm -rf *.tmp *"},
+		{"snake case", "snake_case_name", "snake_case_name"},
+		{"escaped markers", `\*not\* \_this\_`, "*not* _this_"},
+		{"code", "run `go test`", "run " + code("go test")},
+		{"asterisks in code", "`a*b*c`", code("a*b*c")},
+		{"asterisk code inside italic", "*a `*` b*", italic("a " + code("*") + " b")},
+		{"double backticks", "`` a ` b ``", code("a ` b")},
+		{"padded code", "` x `", code("x")},
+		{"unclosed code", "`unclosed *it*", "`unclosed " + italic("it")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderInline(tt.in); got != tt.want {
+				t.Errorf("renderInline(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownLine(t *testing.T) {
+	bold := styleBold.paint
+	italic := styleItalic.paint
+	quote := palette.Muted.paint(glyphQuote) + " "
+
+	tests := []struct {
+		name  string
+		in    string
+		width int
+		want  []string
+	}{
+		{"blank", "   ", 10, []string{""}},
+		{"rule", "---", 10, []string{"──────────"}},
+		{"starred rule", "* * *", 4, []string{"────"}},
+		{"top heading", "# Title", 10, []string{palette.Heading.paint(styleUnderline.paint("Title"))}},
+		{"closed heading", "## Sub ##", 10, []string{palette.Heading.paint("Sub")}},
+		{"bullet", "- item one", 20, []string{"• item one"}},
+		{"nested bullet", "  * nested", 20, []string{"  • nested"}},
+		{"numbered", "3. third", 20, []string{"3. third"}},
+		{"wrapped bullet", "- one two three", 9, []string{"• one two", "  three"}},
+		{"quote", "> quoted *it*", 10, []string{quote + "quoted", quote + italic("it")}},
+		{"indented", "    indented", 10, []string{"    indent", "    ed"}},
+		{"bold across lines", "**bold words that wrap here**", 10, []string{
+			bold("bold words"),
+			bold("that wrap"),
+			bold("here"),
+		}},
+		{"italic opened mid line", "plain *then italic words*", 12, []string{
+			"plain " + italic("then"),
+			italic("italic words"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownLine(tt.in, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("markdownLine(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+ALTER TABLE questions ADD COLUMN uid TEXT;
+
+UPDATE questions SET uid = lower(hex(randomblob(16))) WHERE uid IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_questions_uid ON questions(uid);
+
+CREATE TRIGGER IF NOT EXISTS questions_assign_uid
+AFTER INSERT ON questions
+WHEN NEW.uid IS NULL
+BEGIN
+    UPDATE questions SET uid = lower(hex(randomblob(16))) WHERE id = NEW.id;
+END;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS sync_state (
+    uid TEXT PRIMARY KEY,
+    path TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    synced_at TEXT NOT NULL,
+    deleted_at TEXT
+);
@@ -0,0 +1,51 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS questions_fts USING fts5(question, answers);
+
+INSERT INTO questions_fts(rowid, question, answers)
+SELECT q.id, q.text,
+    COALESCE((SELECT group_concat(a.text, char(10)) FROM answers a WHERE a.question_id = q.id), '')
+FROM questions q;
+
+CREATE TRIGGER IF NOT EXISTS questions_fts_insert
+AFTER INSERT ON questions
+BEGIN
+    INSERT INTO questions_fts(rowid, question, answers) VALUES (NEW.id, NEW.text, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS questions_fts_update
+AFTER UPDATE OF text ON questions
+BEGIN
+    UPDATE questions_fts SET question = NEW.text WHERE rowid = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS questions_fts_delete
+AFTER DELETE ON questions
+BEGIN
+    DELETE FROM questions_fts WHERE rowid = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS answers_fts_insert
+AFTER INSERT ON answers
+BEGIN
+    UPDATE questions_fts
+    SET answers = COALESCE((SELECT group_concat(text, char(10)) FROM answers WHERE question_id = NEW.question_id), '')
+    WHERE rowid = NEW.question_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS answers_fts_update
+AFTER UPDATE ON answers
+BEGIN
+    UPDATE questions_fts
+    SET answers = COALESCE((SELECT group_concat(text, char(10)) FROM answers WHERE question_id = OLD.question_id), '')
+    WHERE rowid = OLD.question_id;
+    UPDATE questions_fts
+    SET answers = COALESCE((SELECT group_concat(text, char(10)) FROM answers WHERE question_id = NEW.question_id), '')
+    WHERE rowid = NEW.question_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS answers_fts_delete
+AFTER DELETE ON answers
+BEGIN
+    UPDATE questions_fts
+    SET answers = COALESCE((SELECT group_concat(text, char(10)) FROM answers WHERE question_id = OLD.question_id), '')
+    WHERE rowid = OLD.question_id;
+END;
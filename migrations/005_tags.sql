@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS question_tags (
+    question_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY(question_id, tag_id),
+    FOREIGN KEY(question_id) REFERENCES questions(id),
+    FOREIGN KEY(tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_tags_tag ON question_tags(tag_id);
+
+CREATE TRIGGER IF NOT EXISTS questions_delete_tags
+AFTER DELETE ON questions
+BEGIN
+    DELETE FROM question_tags WHERE question_id = OLD.id;
+END;
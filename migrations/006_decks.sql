@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS decks (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    color TEXT NOT NULL DEFAULT '',
+    code_lang TEXT NOT NULL DEFAULT '',
+    shuffle INTEGER,
+    session_limit INTEGER
+);
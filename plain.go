@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// plainMode is set by -plain. The study session then runs as a sequence of
+// printed lines and prompts instead of the full-screen UI, with no box
+// drawing, cursor movement or redraws, so it works with screen readers,
+// dumb terminals and pipes.
+var plainMode bool
+
+// plainInput is where -plain reads its prompts. It is the terminal instead
+// of stdin when the deck itself was read from stdin.
+var plainInput io.Reader = os.Stdin
+
+const plainHelp = `Commands:
+  Enter      show the answers, then go to the next card
+  p          previous card
+  r          repeat this card
+  /TEXT      jump to the next card matching TEXT
+  ?          this help
+  q          quit`
+
+// usePlainGlyphs swaps the box drawing and symbols used in card text for
+// ASCII.
+func usePlainGlyphs() {
+	glyphRule = "-"
+	glyphBullet = "-"
+	glyphQuote = ">"
+	glyphFrameTop = "+"
+	glyphFrameSide = "|"
+	glyphFrameBottom = "+"
+	glyphFrameRule = "-"
+	glyphMark = ">"
+}
+
+// plainWidth is the wrap width of plain output: $COLUMNS, or 80.
+func plainWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n >= 20 {
+		return n
+	}
+	return 80
+}
+
+type plainSession struct {
+	in  *bufio.Scanner
+	out io.Writer
+	m   model
+}
+
+func runPlain(in io.Reader, out io.Writer, m model) error {
+	s := &plainSession{in: bufio.NewScanner(in), out: out, m: m}
+	if m.mode == modeGroup {
+		ok, err := s.chooseGroup()
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return s.study()
+}
+
+// prompt prints label and reads one line. ok is false at end of input.
+func (s *plainSession) prompt(label string) (string, bool) {
+	fmt.Fprint(s.out, label)
+	if !s.in.Scan() {
+		fmt.Fprintln(s.out)
+		return "", false
+	}
+	return strings.TrimSpace(s.in.Text()), true
+}
+
+func (s *plainSession) chooseGroup() (bool, error) {
+	for {
+		fmt.Fprintf(s.out, "Groups by %s:\n", s.m.groupBy)
+		for i, g := range s.m.groups {
+			name := g.Type
+			if strings.TrimSpace(name) == "" {
+				name = "(none)"
+			}
+			fmt.Fprintf(s.out, "%d. %s (%d)\n", i+1, name, g.Count)
+		}
+		answer, ok := s.prompt("Choose a group by number, or q to quit: ")
+		if !ok || answer == "q" {
+			return false, nil
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(s.m.groups) {
+			fmt.Fprintf(s.out, "No group %q.\n\n", answer)
+			continue
+		}
+
+		selected := s.m.groups[n-1].Type
+		filter := questionFilter{Type: selected}
+		deck := resolveDeck(s.m.decks, selected)
+		if s.m.groupBy == "tag" {
+			filter = questionFilter{Tags: []string{selected}}
+			deck = resolveDeck(nil, "")
+		}
+		questions, err := loadQuestions(s.m.db, filter)
+		if err != nil {
+			return false, err
+		}
+		s.m.questions = prepareSession(questions, deck)
+		s.m.index = 0
+		return true, nil
+	}
+}
+
+func (s *plainSession) study() error {
+	width := plainWidth()
+	for s.m.index < len(s.m.questions) {
+		q := s.m.questions[s.m.index]
+		deck := s.m.cardDeck(q)
+		header := fmt.Sprintf("Card %d of %d", s.m.index+1, len(s.m.questions))
+		if q.Type != "" {
+			header += ", " + q.Type
+		}
+		fmt.Fprintln(s.out, header)
+		fmt.Fprintln(s.out, "Question:")
+		s.printLines(renderBody(strings.Trim(q.Text, "\r\n"), width, deck.CodeLang))
+
+		answer, ok := s.prompt("Press Enter to show the answers: ")
+		if !ok {
+			return nil
+		}
+		if answer == "" {
+			fmt.Fprintln(s.out, "Answers:")
+			if len(q.Answers) == 0 {
+				fmt.Fprintln(s.out, "(no answers stored)")
+			}
+			for _, a := range q.Answers {
+				s.printLines(formatAnswerLines(a, width, deck.CodeLang))
+			}
+			answer, ok = s.prompt("Enter for the next card, ? for commands: ")
+			if !ok {
+				return nil
+			}
+		}
+		fmt.Fprintln(s.out)
+		if quit := s.command(answer); quit {
+			return nil
+		}
+	}
+	fmt.Fprintln(s.out, "No more questions in this session.")
+	return nil
+}
+
+// command runs a command typed at a prompt and reports whether to quit.
+func (s *plainSession) command(answer string) bool {
+	switch {
+	case answer == "":
+		s.m.index++
+	case answer == "q":
+		return true
+	case answer == "p":
+		if s.m.index > 0 {
+			s.m.index--
+		}
+	case answer == "r":
+	case answer == "?":
+		fmt.Fprintln(s.out, plainHelp)
+		fmt.Fprintln(s.out)
+	case strings.HasPrefix(answer, "/"):
+		matches, err := findMatches(s.m.db, s.m.questions, strings.TrimPrefix(answer, "/"))
+		if err != nil {
+			fmt.Fprintln(s.out, "Search failed:", err)
+			break
+		}
+		if len(matches) == 0 {
+			fmt.Fprintln(s.out, "No matches.")
+			break
+		}
+		// Go to the first match after the current card, wrapping around.
+		next := -1
+		for _, i := range matches {
+			if i > s.m.index && (next < 0 || i < next) {
+				next = i
+			}
+		}
+		if next < 0 {
+			next = slices.Min(matches)
+		}
+		fmt.Fprintf(s.out, "Found %d, showing card %d.\n", len(matches), next+1)
+		s.m.index = next
+	default:
+		fmt.Fprintf(s.out, "Unknown command %q.\n%s\n\n", answer, plainHelp)
+	}
+	return false
+}
+
+func (s *plainSession) printLines(lines []string) {
+	for _, line := range lines {
+		fmt.Fprintln(s.out, strings.TrimRight(line, " "))
+	}
+}
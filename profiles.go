@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Profiles are separate databases kept next to the default one, e.g.
+// ~/.fcards/profiles/work.db. The "default" profile is flashcards.db itself.
+const defaultProfile = "default"
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// resolveDBPath picks the database to open: -db wins over -profile, which
+// wins over $FCARDS_DB, which wins over the default profile.
+func resolveDBPath(dataDir, dbFlag, profile string) (string, error) {
+	path := dbFlag
+	switch {
+	case path != "":
+	case profile != "":
+		p, err := profilePath(dataDir, profile)
+		if err != nil {
+			return "", err
+		}
+		path = p
+	case os.Getenv("FCARDS_DB") != "":
+		path = os.Getenv("FCARDS_DB")
+	default:
+		path = filepath.Join(dataDir, "flashcards.db")
+	}
+
+	path = expandHome(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func profilePath(dataDir, name string) (string, error) {
+	if name == defaultProfile {
+		return filepath.Join(dataDir, "flashcards.db"), nil
+	}
+	if !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	return filepath.Join(dataDir, "profiles", name+".db"), nil
+}
+
+// listProfiles returns the names of all profiles that have a database.
+func listProfiles(dataDir string) ([]string, error) {
+	names := []string{defaultProfile}
+	entries, err := os.ReadDir(filepath.Join(dataDir, "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var others []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".db" {
+			continue
+		}
+		others = append(others, strings.TrimSuffix(name, ".db"))
+	}
+	sort.Strings(others)
+	return append(names, others...), nil
+}
+
+func runProfiles(dataDir, activePath string) error {
+	names, err := listProfiles(dataDir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, name := range names {
+		path, err := profilePath(dataDir, name)
+		if err != nil {
+			return err
+		}
+		marker := "  "
+		if samePath(path, activePath) {
+			marker = "* "
+			found = true
+		}
+		fmt.Printf("%s%-12s %s\n", marker, name, path)
+	}
+	if !found {
+		fmt.Printf("* %-12s %s\n", "(custom)", activePath)
+	}
+	return nil
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Markers passed to the FTS5 highlight/snippet functions. They are swapped
+// for terminal colours when printed.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+type searchHit struct {
+	ID       int
+	Type     string
+	Question string
+	Snippet  string
+}
+
+func runSearch(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	var limit int
+	fs.IntVar(&limit, "limit", 20, "maximum number of results")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf(`usage: fcards search "goroutine leak"`)
+	}
+
+	hits, err := searchQuestions(db, query, limit)
+	if err != nil {
+		return err
+	}
+	if len(hits) == 0 {
+		fmt.Println("No matches.")
+		return nil
+	}
+	for _, hit := range hits {
+		name := hit.Type
+		if strings.TrimSpace(name) == "" {
+			name = "(none)"
+		}
+		fmt.Printf("%s#%d%s %s  %s\n", accentColor(""), hit.ID, reset, name, colorMatches(firstLine(hit.Question)))
+		if strings.Contains(hit.Snippet, matchStart) {
+			snippet := strings.Join(strings.Fields(hit.Snippet), " ")
+			fmt.Printf("    %s\n", colorMatches(snippet))
+		}
+	}
+	return nil
+}
+
+// searchQuestions runs a full-text search over question and answer text,
+// best matches first. Every word in query must match, as a prefix.
+func searchQuestions(db *sql.DB, query string, limit int) ([]searchHit, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	rows, err := db.Query(`
+		SELECT q.id, q.type,
+			highlight(questions_fts, 0, ?, ?),
+			snippet(questions_fts, 1, ?, ?, '…', 12)
+		FROM questions_fts
+		JOIN questions q ON q.id = questions_fts.rowid
+		WHERE questions_fts MATCH ?
+		ORDER BY rank
+		LIMIT ?;
+	`, matchStart, matchEnd, matchStart, matchEnd, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []searchHit
+	for rows.Next() {
+		var hit searchHit
+		if err := rows.Scan(&hit.ID, &hit.Type, &hit.Question, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// ftsQuery quotes each word so user input never trips over FTS5 query
+// syntax.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func colorMatches(text string) string {
+	text = strings.ReplaceAll(text, matchStart, accentColor(""))
+	return strings.ReplaceAll(text, matchEnd, reset)
+}
+
+// findMatches returns the indexes into questions that match query, best
+// match first. Without a database it falls back to a plain substring
+// search, e.g. when studying a deck file.
+func findMatches(db *sql.DB, questions []Question, query string) ([]int, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	var matches []int
+	if db == nil {
+		needle := strings.ToLower(strings.TrimSpace(query))
+		for i, q := range questions {
+			text := strings.ToLower(q.Text + "\n" + strings.Join(q.Answers, "\n"))
+			if strings.Contains(text, needle) {
+				matches = append(matches, i)
+			}
+		}
+		return matches, nil
+	}
+
+	hits, err := searchQuestions(db, query, -1)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[int]int, len(questions))
+	for i, q := range questions {
+		index[q.ID] = i
+	}
+	for _, hit := range hits {
+		if i, ok := index[hit.ID]; ok {
+			matches = append(matches, i)
+		}
+	}
+	return matches, nil
+}
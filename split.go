@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// On terminals at least cfg.SplitMinWidth wide the card is drawn as two
+// panes, question on the left and answers on the right. Each pane scrolls
+// on its own; up/down move the focused one.
+
+const (
+	paneQuestion = iota
+	paneAnswers
+)
+
+func (m model) splitView() bool {
+	return m.split && cfg.SplitMinWidth > 0 && m.width >= cfg.SplitMinWidth
+}
+
+// splitPaneWidths divides the terminal between the two panes.
+func splitPaneWidths(termWidth int) (int, int) {
+	left := termWidth / 2
+	return left, termWidth - left
+}
+
+// paneContentWidth is the room for text inside a pane of width columns.
+func paneContentWidth(width int) int {
+	return max(width-4, 1)
+}
+
+// paneVisibleLines is how many content lines fit in a pane, leaving room
+// for the borders, the title and the footer under the panes.
+func paneVisibleLines(height int) int {
+	if height <= 0 {
+		return 1 << 30
+	}
+	return max(height-5, 1)
+}
+
+func questionPaneLines(q Question, width int, codeLang string, wrap bool) []string {
+	key := renderKey{"question", cardCacheKey(q), false, width, codeLang, wrap}
+	return cardLines.lines(key, func() []string {
+		return renderQuestionPane(q, width, codeLang, wrap)
+	})
+}
+
+func renderQuestionPane(q Question, width int, codeLang string, wrap bool) []string {
+	lines := renderBody(strings.Trim(q.Text, "\r\n"), width, codeLang)
+	if wrap {
+		lines = softWrapLines(lines, width)
+	}
+	return lines
+}
+
+func answerPaneLines(q Question, showAnswers bool, width int, codeLang string, wrap bool) []string {
+	key := renderKey{"answers", cardCacheKey(q), showAnswers, width, codeLang, wrap}
+	return cardLines.lines(key, func() []string {
+		return renderAnswerPane(q, showAnswers, width, codeLang, wrap)
+	})
+}
+
+func renderAnswerPane(q Question, showAnswers bool, width int, codeLang string, wrap bool) []string {
+	if !showAnswers {
+		if key := keymap.key(modeCards, actFlip); key != "" {
+			return []string{palette.Muted.paint("Press " + key + " to show the answers.")}
+		}
+		return nil
+	}
+	if len(q.Answers) == 0 {
+		return []string{palette.Muted.paint("(no answers stored)")}
+	}
+	var lines []string
+	for _, ans := range q.Answers {
+		lines = append(lines, formatAnswerLines(ans, width, codeLang)...)
+	}
+	if wrap {
+		lines = softWrapLines(lines, width)
+	}
+	return lines
+}
+
+func splitPaneLines(q Question, deck Deck, showAnswers, wrap bool, termWidth int) ([]string, []string) {
+	left, right := splitPaneWidths(termWidth)
+	return questionPaneLines(q, paneContentWidth(left), deck.CodeLang, wrap),
+		answerPaneLines(q, showAnswers, paneContentWidth(right), deck.CodeLang, wrap)
+}
+
+func splitMaxScroll(q Question, deck Deck, showAnswers, wrap bool, focus, termWidth, termHeight int) int {
+	questionLines, answerLines := splitPaneLines(q, deck, showAnswers, wrap, termWidth)
+	lines := questionLines
+	if focus == paneAnswers {
+		lines = answerLines
+	}
+	return max(0, len(lines)-paneVisibleLines(termHeight))
+}
+
+func splitMaxHScroll(q Question, deck Deck, showAnswers, wrap bool, termWidth int) int {
+	if wrap {
+		return 0
+	}
+	left, right := splitPaneWidths(termWidth)
+	questionLines, answerLines := splitPaneLines(q, deck, showAnswers, false, termWidth)
+	return max(0, max(
+		maxLineWidth(questionLines)-paneContentWidth(left),
+		maxLineWidth(answerLines)-paneContentWidth(right)))
+}
+
+func (m model) renderSplit(q Question, deck Deck, height int) string {
+	leftWidth, rightWidth := splitPaneWidths(m.width)
+	questionLines, answerLines := splitPaneLines(q, deck, m.showAnswers, m.softWrap, m.width)
+	visible := min(paneVisibleLines(height), max(max(len(questionLines), len(answerLines)), 1))
+
+	accent := accentColor(deck.Color)
+	borders := [2]string{accent, accent}
+	if !noColor && palette.Muted.on != "" {
+		borders[1-m.focus] = palette.Muted.on
+	}
+	// The focused pane's title is marked too, for when colours are off or
+	// the theme has no muted style.
+	titles := [2]string{"  QUESTION", "  ANSWERS"}
+	titles[m.focus] = "> " + titles[m.focus][2:]
+	left := renderPane(titles[paneQuestion], fmt.Sprintf("%d/%d", m.index+1, len(m.questions)),
+		questionLines, leftWidth, visible, m.scrollOffset, m.hScroll, borders[paneQuestion])
+	right := renderPane(titles[paneAnswers], "", answerLines, rightWidth, visible, m.answerScroll, m.hScroll, borders[paneAnswers])
+
+	var builder strings.Builder
+	for i := range left {
+		builder.WriteString(left[i] + right[i] + "\n")
+	}
+
+	hints := []hint{{"flip", []string{actFlip}}, {"prev/next", []string{actPrev, actNext}}, {"help", []string{actHelp}},
+		{"scroll", []string{actUp, actDown}}, {"switch pane", []string{actFocus}}, {"one card", []string{actSplit}}}
+	if m.maxHScroll() > 0 {
+		hints = append(hints, hint{"pan", []string{actScrollLeft, actScrollRight}}, hint{"wrap", []string{actWrap}})
+	}
+	builder.WriteString(palette.Muted.paint(keymap.fitHints(modeCards, m.width, hints...)))
+	return builder.String()
+}
+
+// renderPane draws a bordered pane showing visible lines of content from
+// scroll on. The title row notes when there is more to scroll to.
+func renderPane(title, info string, lines []string, width, visible, scroll, hScroll int, border string) []string {
+	inner := width - 2
+	edge := func(text string) string {
+		return border + "|" + reset + " " + padRight(text, inner-2) + " " + border + "|" + reset
+	}
+	rule := border + "+" + strings.Repeat("-", inner) + "+" + reset
+
+	scroll = clampScroll(scroll, max(0, len(lines)-visible))
+	var more []string
+	if scroll > 0 {
+		more = append(more, "↑")
+	}
+	if scroll+visible < len(lines) {
+		more = append(more, "↓")
+	}
+	if info != "" {
+		more = append(more, info)
+	}
+	info = strings.Join(more, " ")
+	heading := palette.Heading.paint(title)
+	out := []string{rule, edge(padRight(heading, inner-2-visualWidth(info)) + info), rule}
+	for i := 0; i < visible; i++ {
+		text := ""
+		if scroll+i < len(lines) {
+			text = clipColumns(lines[scroll+i], hScroll, inner-2)
+		}
+		out = append(out, edge(text))
+	}
+	return append(out, rule)
+}
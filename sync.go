@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// sync_state remembers what each card looked like the last time a deck
+// directory was synced, which is how sync tells "edited in the file" apart
+// from "edited in the database" and spots cards removed from the files.
+
+type syncState struct {
+	Path    string
+	Hash    string
+	Deleted bool
+}
+
+type syncReport struct {
+	Inserted     int
+	UpdatedDB    int
+	UpdatedFiles []string
+	Conflicts    []string
+	Flagged      []string
+	Skipped      []string
+}
+
+func runSync(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	var watch bool
+	var prefer string
+	fs.BoolVar(&watch, "watch", false, "keep running and re-sync when deck files change")
+	fs.StringVar(&prefer, "prefer", "", "resolve conflicts in favour of this side (file or db)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: fcards sync [-watch] [-prefer file|db] DIR")
+	}
+	if prefer != "" && prefer != "file" && prefer != "db" {
+		return fmt.Errorf("-prefer must be file or db")
+	}
+	dir, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report, err := syncDir(db, dir, prefer)
+	if err != nil {
+		return err
+	}
+	printSyncReport(report, true)
+	if !watch {
+		return nil
+	}
+	// Skipped files are only reported again when they change, not on
+	// every event.
+	skipped := report.Skipped
+	return watchDir(dir, func() {
+		report, err := syncDir(db, dir, prefer)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "sync error:", err)
+			return
+		}
+		skippedChanged := !slices.Equal(report.Skipped, skipped)
+		skipped = report.Skipped
+		if !report.empty() || skippedChanged {
+			printSyncReport(report, skippedChanged)
+		}
+	})
+}
+
+func syncDir(db *sql.DB, dir, prefer string) (syncReport, error) {
+	var report syncReport
+
+	states, err := loadSyncStates(db)
+	if err != nil {
+		return report, err
+	}
+	tracked := make(map[string]bool)
+	for _, state := range states {
+		tracked[state.Path] = true
+	}
+
+	paths, skipped, err := deckPaths(dir, tracked)
+	if err != nil {
+		return report, err
+	}
+	report.Skipped = skipped
+
+	questions, err := loadQuestions(db, questionFilter{})
+	if err != nil {
+		return report, err
+	}
+	byUID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byUID[q.UID] = q
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	record := func(q Question, path string) error {
+		_, err := tx.Exec(`
+			INSERT INTO sync_state(uid, path, hash, synced_at, deleted_at) VALUES (?, ?, ?, ?, NULL)
+			ON CONFLICT(uid) DO UPDATE SET path = excluded.path, hash = excluded.hash,
+				synced_at = excluded.synced_at, deleted_at = NULL;`,
+			q.UID, path, cardHash(q), now)
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		deck, err := readDeckFile(path)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", path, err)
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fileChanged := false
+
+		for i, card := range deck.Cards {
+			label := fmt.Sprintf("%s: %q", rel, firstLine(card.Text))
+			dbCard, inDB := byUID[card.UID]
+			state, tracked := states[card.UID]
+
+			switch {
+			case card.UID == "" || (!inDB && !tracked):
+				id, status, err := saveQuestion(tx, card)
+				if err != nil {
+					return report, err
+				}
+				if err := tx.QueryRow(`SELECT uid FROM questions WHERE id = ?;`, id).Scan(&card.UID); err != nil {
+					return report, err
+				}
+				if deck.Cards[i].UID != card.UID {
+					deck.Cards[i].UID = card.UID
+					fileChanged = true
+				}
+				switch status {
+				case saveInserted:
+					report.Inserted++
+				case saveUpdated:
+					report.UpdatedDB++
+				}
+			case !inDB:
+				if !state.Deleted {
+					report.Flagged = append(report.Flagged, label+" was deleted from the database")
+					if _, err := tx.Exec(`UPDATE sync_state SET deleted_at = ? WHERE uid = ?;`, now, card.UID); err != nil {
+						return report, err
+					}
+				}
+				seen[card.UID] = true
+				continue
+			default:
+				fileHash, dbHash := cardHash(card), cardHash(dbCard)
+				switch {
+				case fileHash == dbHash:
+				case tracked && state.Hash == dbHash, prefer == "file":
+					if _, _, err := saveQuestion(tx, card); err != nil {
+						return report, err
+					}
+					report.UpdatedDB++
+				case tracked && state.Hash == fileHash, prefer == "db":
+					card = dbCard
+					deck.Cards[i] = dbCard
+					fileChanged = true
+				default:
+					report.Conflicts = append(report.Conflicts, label+" changed in both the file and the database")
+					seen[card.UID] = true
+					continue
+				}
+			}
+
+			seen[card.UID] = true
+			if err := record(card, path); err != nil {
+				return report, err
+			}
+		}
+
+		if fileChanged {
+			if err := writeDeckFile(path, deck); err != nil {
+				return report, err
+			}
+			report.UpdatedFiles = append(report.UpdatedFiles, rel)
+		}
+	}
+
+	for uid, state := range states {
+		if seen[uid] || state.Deleted || !withinDir(dir, state.Path) {
+			continue
+		}
+		q, ok := byUID[uid]
+		if !ok {
+			if _, err := tx.Exec(`DELETE FROM sync_state WHERE uid = ?;`, uid); err != nil {
+				return report, err
+			}
+			continue
+		}
+		rel, _ := filepath.Rel(dir, state.Path)
+		report.Flagged = append(report.Flagged,
+			fmt.Sprintf("%s: %q was removed from the file (kept in the database)", rel, firstLine(q.Text)))
+		if _, err := tx.Exec(`UPDATE sync_state SET deleted_at = ? WHERE uid = ?;`, now, uid); err != nil {
+			return report, err
+		}
+	}
+
+	return report, tx.Commit()
+}
+
+func (r syncReport) empty() bool {
+	return r.Inserted == 0 && r.UpdatedDB == 0 && len(r.UpdatedFiles) == 0 &&
+		len(r.Conflicts) == 0 && len(r.Flagged) == 0
+}
+
+func printSyncReport(report syncReport, showSkipped bool) {
+	fmt.Printf("%d new, %d updated in database, %d files rewritten\n",
+		report.Inserted, report.UpdatedDB, len(report.UpdatedFiles))
+	for _, path := range report.UpdatedFiles {
+		fmt.Println("  wrote", path)
+	}
+	for _, msg := range report.Flagged {
+		fmt.Println("  deleted:", msg)
+	}
+	for _, msg := range report.Conflicts {
+		fmt.Println("  conflict:", msg)
+	}
+	if showSkipped && len(report.Skipped) > 0 {
+		fmt.Printf("  skipped %d .md files that are not decks (see \"Syncing a directory of decks\" in the README)\n", len(report.Skipped))
+	}
+}
+
+func loadSyncStates(db *sql.DB) (map[string]syncState, error) {
+	rows, err := db.Query(`SELECT uid, path, hash, deleted_at FROM sync_state;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]syncState)
+	for rows.Next() {
+		var uid string
+		var state syncState
+		var deletedAt sql.NullString
+		if err := rows.Scan(&uid, &state.Path, &state.Hash, &deletedAt); err != nil {
+			return nil, err
+		}
+		state.Deleted = deletedAt.Valid
+		states[uid] = state
+	}
+	return states, rows.Err()
+}
+
+// deckPaths lists the deck files under dir and the other .md files it
+// skipped. A file is a deck if it opts in, see isDeckFile, or if it was
+// synced before.
+func deckPaths(dir string, tracked map[string]bool) ([]string, []string, error) {
+	var paths, skipped []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		isDeck, err := isDeckFile(path)
+		if err != nil {
+			return err
+		}
+		if isDeck || tracked[path] {
+			paths = append(paths, path)
+		} else {
+			skipped = append(skipped, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	sort.Strings(skipped)
+	return paths, skipped, err
+}
+
+// isDeckFile reports whether a markdown file opts in to sync: its name ends
+// in .deck.md or its front matter sets a type. Other notes in the same
+// directory are left alone.
+func isDeckFile(path string) (bool, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".deck.md") {
+		return true, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || strings.TrimRight(scanner.Text(), "\r") != "---" {
+		return false, scanner.Err()
+	}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "---" {
+			return false, nil
+		}
+		if key, _, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "type" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func readDeckFile(path string) (deckFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return deckFile{}, err
+	}
+	defer f.Close()
+	return parseDeck(f)
+}
+
+// writeDeckFile replaces path via a temporary file so an editor or a
+// concurrent sync never sees a half-written deck.
+func writeDeckFile(path string, deck deckFile) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fcards-*.md")
+	if err != nil {
+		return err
+	}
+	if err := writeDeck(tmp, deck); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		_ = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func watchDir(dir string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("watching", dir, "(ctrl+c to stop)")
+
+	// Editors often write a file in several steps, so wait for a short
+	// quiet period before syncing.
+	var pending <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = watcher.Add(event.Name)
+				}
+			}
+			if strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue
+			}
+			pending = time.After(300 * time.Millisecond)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, "watch error:", err)
+		case <-pending:
+			pending = nil
+			onChange()
+		}
+	}
+}
+
+func cardHash(q Question) string {
+	h := sha256.New()
+	h.Write([]byte(q.Type))
+	h.Write([]byte{0})
+	h.Write([]byte(q.Text))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(sortedTags(q.Tags), ",")))
+	for _, ans := range q.Answers {
+		h.Write([]byte{0})
+		h.Write([]byte(ans))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
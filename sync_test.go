@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDeck = `---
+type: go
+---
+
+## What is a goroutine?
+
+- A lightweight thread
+
+## Who closes a channel?
+
+- The sender
+`
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is its own database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// syncedDeck writes testDeck into a new directory and syncs it once, so
+// every card has an id and a recorded state.
+func syncedDeck(t *testing.T) (*sql.DB, string, string) {
+	t.Helper()
+	db := newTestDB(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go.md")
+	if err := os.WriteFile(path, []byte(testDeck), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, db, dir, "")
+	return db, dir, path
+}
+
+func mustSync(t *testing.T, db *sql.DB, dir, prefer string) syncReport {
+	t.Helper()
+	report, err := syncDir(db, dir, prefer)
+	if err != nil {
+		t.Fatalf("syncDir: %v", err)
+	}
+	return report
+}
+
+func mustReadDeck(t *testing.T, path string) deckFile {
+	t.Helper()
+	deck, err := readDeckFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deck
+}
+
+// editFileAnswer changes the first answer of card i in the deck at path.
+func editFileAnswer(t *testing.T, path string, i int, answer string) {
+	t.Helper()
+	deck := mustReadDeck(t, path)
+	deck.Cards[i].Answers[0] = answer
+	if err := writeDeckFile(path, deck); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func editDBAnswer(t *testing.T, db *sql.DB, uid, answer string) {
+	t.Helper()
+	if _, err := db.Exec(`UPDATE answers SET text = ? WHERE question_id = (SELECT id FROM questions WHERE uid = ?);`, answer, uid); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dbAnswers(t *testing.T, db *sql.DB, uid string) []string {
+	t.Helper()
+	questions, err := loadQuestions(db, questionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range questions {
+		if q.UID == uid {
+			return q.Answers
+		}
+	}
+	return nil
+}
+
+func TestSyncInsertsNewCards(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go.md")
+	if err := os.WriteFile(path, []byte(testDeck), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := mustSync(t, db, dir, "")
+	if report.Inserted != 2 || !reflect.DeepEqual(report.UpdatedFiles, []string{"go.md"}) {
+		t.Fatalf("first sync = %+v, want 2 inserted and go.md rewritten", report)
+	}
+	for _, card := range mustReadDeck(t, path).Cards {
+		if card.UID == "" {
+			t.Errorf("card %q has no id written back", card.Text)
+		}
+	}
+	if report := mustSync(t, db, dir, ""); !report.empty() {
+		t.Errorf("second sync = %+v, want nothing to do", report)
+	}
+}
+
+func TestSyncFileChange(t *testing.T) {
+	db, dir, path := syncedDeck(t)
+	uid := mustReadDeck(t, path).Cards[0].UID
+	editFileAnswer(t, path, 0, "A goroutine")
+
+	report := mustSync(t, db, dir, "")
+	if report.UpdatedDB != 1 || len(report.UpdatedFiles) != 0 || len(report.Conflicts) != 0 {
+		t.Fatalf("sync = %+v, want one database update", report)
+	}
+	if got := dbAnswers(t, db, uid); !reflect.DeepEqual(got, []string{"A goroutine"}) {
+		t.Errorf("database answers = %q", got)
+	}
+}
+
+func TestSyncDatabaseChange(t *testing.T) {
+	db, dir, path := syncedDeck(t)
+	uid := mustReadDeck(t, path).Cards[1].UID
+	editDBAnswer(t, db, uid, "Only the sender")
+
+	report := mustSync(t, db, dir, "")
+	if report.UpdatedDB != 0 || !reflect.DeepEqual(report.UpdatedFiles, []string{"go.md"}) {
+		t.Fatalf("sync = %+v, want go.md rewritten", report)
+	}
+	if got := mustReadDeck(t, path).Cards[1].Answers; !reflect.DeepEqual(got, []string{"Only the sender"}) {
+		t.Errorf("file answers = %q", got)
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	tests := []struct {
+		prefer    string
+		conflicts int
+		want      string // the answer both sides end with, or "" when left alone
+	}{
+		{prefer: "", conflicts: 1},
+		{prefer: "file", want: "from the file"},
+		{prefer: "db", want: "from the database"},
+	}
+	for _, tt := range tests {
+		t.Run("prefer "+tt.prefer, func(t *testing.T) {
+			db, dir, path := syncedDeck(t)
+			uid := mustReadDeck(t, path).Cards[0].UID
+			editFileAnswer(t, path, 0, "from the file")
+			editDBAnswer(t, db, uid, "from the database")
+
+			report := mustSync(t, db, dir, tt.prefer)
+			if len(report.Conflicts) != tt.conflicts {
+				t.Fatalf("conflicts = %q, want %d", report.Conflicts, tt.conflicts)
+			}
+			fileAnswer := mustReadDeck(t, path).Cards[0].Answers[0]
+			dbAnswer := dbAnswers(t, db, uid)[0]
+			if tt.want == "" {
+				if fileAnswer != "from the file" || dbAnswer != "from the database" {
+					t.Errorf("conflict changed a side: file %q, database %q", fileAnswer, dbAnswer)
+				}
+				return
+			}
+			if fileAnswer != tt.want || dbAnswer != tt.want {
+				t.Errorf("file %q, database %q, want both %q", fileAnswer, dbAnswer, tt.want)
+			}
+			if report := mustSync(t, db, dir, ""); !report.empty() {
+				t.Errorf("sync after resolving = %+v, want nothing to do", report)
+			}
+		})
+	}
+}
+
+func TestSyncCardRemovedFromFile(t *testing.T) {
+	db, dir, path := syncedDeck(t)
+	deck := mustReadDeck(t, path)
+	uid := deck.Cards[0].UID
+	deck.Cards = deck.Cards[1:]
+	if err := writeDeckFile(path, deck); err != nil {
+		t.Fatal(err)
+	}
+
+	report := mustSync(t, db, dir, "")
+	if len(report.Flagged) != 1 || !strings.Contains(report.Flagged[0], "removed from the file") {
+		t.Fatalf("flagged = %q, want the removed card", report.Flagged)
+	}
+	if dbAnswers(t, db, uid) == nil {
+		t.Error("the removed card was deleted from the database")
+	}
+	if report := mustSync(t, db, dir, ""); len(report.Flagged) != 0 {
+		t.Errorf("flagged again: %q", report.Flagged)
+	}
+}
+
+func TestSyncCardDeletedFromDatabase(t *testing.T) {
+	db, dir, path := syncedDeck(t)
+	uid := mustReadDeck(t, path).Cards[0].UID
+	if _, err := db.Exec(`DELETE FROM questions WHERE uid = ?;`, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	report := mustSync(t, db, dir, "")
+	if len(report.Flagged) != 1 || !strings.Contains(report.Flagged[0], "deleted from the database") {
+		t.Fatalf("flagged = %q, want the deleted card", report.Flagged)
+	}
+	if report.Inserted != 0 || len(report.UpdatedFiles) != 0 {
+		t.Errorf("sync = %+v, want the card neither re-inserted nor removed from the file", report)
+	}
+	if got := len(mustReadDeck(t, path).Cards); got != 2 {
+		t.Errorf("file has %d cards, want 2", got)
+	}
+	if report := mustSync(t, db, dir, ""); len(report.Flagged) != 0 {
+		t.Errorf("flagged again: %q", report.Flagged)
+	}
+}
+
+func TestSyncSkipsFilesThatAreNotDecks(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"notes.md":            "---\ntitle: notes\n---\n\n## Not a card\n- a list\n",
+		"readme.md":           "## Also not a card\n- x\n",
+		"sql.deck.md":         "## Which clause filters rows? <!-- type: sql -->\n- WHERE\n",
+		".hidden/go.md":       testDeck,
+		"decks/go.md":         testDeck,
+		"decks/unrelated.txt": "## Not markdown\n- x\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := mustSync(t, db, dir, "")
+	if report.Inserted != 3 {
+		t.Errorf("inserted %d cards, want 3", report.Inserted)
+	}
+	wantSkipped := []string{filepath.Join(dir, "notes.md"), filepath.Join(dir, "readme.md")}
+	if !reflect.DeepEqual(report.Skipped, wantSkipped) {
+		t.Errorf("skipped = %q, want %q", report.Skipped, wantSkipped)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "readme.md")); string(data) != files["readme.md"] {
+		t.Errorf("readme.md was rewritten:\n%s", data)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/muesli/termenv"
+)
+
+// Theme describes the colours of the UI. Every field except ChromaStyle is
+// a style spec: words such as "bold", "italic", "underline", "reverse" or
+// "dim", a foreground colour ("208" or "#rrggbb") and "on COLOUR" for the
+// background, e.g. "bold 231 on 24". An empty spec leaves the text plain.
+type Theme struct {
+	// Base names the built-in theme a custom theme starts from.
+	Base        string `toml:"base,omitempty"`
+	Border      string `toml:"border,omitempty"`
+	Heading     string `toml:"heading,omitempty"`
+	Selection   string `toml:"selection,omitempty"`
+	Error       string `toml:"error,omitempty"`
+	Muted       string `toml:"muted,omitempty"`
+	Code        string `toml:"code,omitempty"`
+	ChromaStyle string `toml:"chroma_style,omitempty"`
+}
+
+var themePresets = map[string]Theme{
+	"dark": {
+		Border:      "208",
+		Heading:     "bold",
+		Selection:   "208",
+		Error:       "bold 203",
+		Muted:       "245",
+		Code:        "216 on 236",
+		ChromaStyle: "monokai",
+	},
+	"light": {
+		Border:      "166",
+		Heading:     "bold 24",
+		Selection:   "bold 166",
+		Error:       "bold 160",
+		Muted:       "242",
+		Code:        "88 on 254",
+		ChromaStyle: "github",
+	},
+	// high-contrast only uses the terminal's own colours plus attributes,
+	// so it reads the same on light and dark backgrounds.
+	"high-contrast": {
+		Border:      "bold",
+		Heading:     "bold underline",
+		Selection:   "reverse",
+		Error:       "bold reverse",
+		Muted:       "",
+		Code:        "bold",
+		ChromaStyle: "bw",
+	},
+}
+
+// themeStyles is a theme compiled to escape sequences.
+type themeStyles struct {
+	Border      sgrStyle
+	Heading     sgrStyle
+	Selection   sgrStyle
+	Error       sgrStyle
+	Muted       sgrStyle
+	Code        sgrStyle
+	ChromaStyle string
+}
+
+// palette is the active theme, set up in main.
+var palette, _ = compileTheme(themePresets["dark"])
+
+// resolveTheme picks the configured theme, a built-in or one of the custom
+// themes in the config, and applies the chroma_style and colors.accent
+// overrides on top.
+func resolveTheme(c Config) (Theme, error) {
+	t, ok := themePresets[c.Theme]
+	if custom, isCustom := c.Themes[c.Theme]; isCustom {
+		base := custom.Base
+		if base == "" {
+			base = "dark"
+		}
+		if t, ok = themePresets[base]; !ok {
+			return t, fmt.Errorf("theme %q: unknown base theme %q", c.Theme, base)
+		}
+		t = overlayTheme(t, custom)
+	} else if !ok {
+		return t, fmt.Errorf("unknown theme %q", c.Theme)
+	}
+	if c.ChromaStyle != "" {
+		t.ChromaStyle = c.ChromaStyle
+	}
+	if c.Colors.Accent != "" {
+		t.Border = c.Colors.Accent
+	}
+	return t, nil
+}
+
+func overlayTheme(t, custom Theme) Theme {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&t.Border, custom.Border},
+		{&t.Heading, custom.Heading},
+		{&t.Selection, custom.Selection},
+		{&t.Error, custom.Error},
+		{&t.Muted, custom.Muted},
+		{&t.Code, custom.Code},
+		{&t.ChromaStyle, custom.ChromaStyle},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return t
+}
+
+func compileTheme(t Theme) (themeStyles, error) {
+	compiled := themeStyles{ChromaStyle: t.ChromaStyle}
+	for _, f := range []struct {
+		name string
+		dst  *sgrStyle
+		spec string
+	}{
+		{"border", &compiled.Border, t.Border},
+		{"heading", &compiled.Heading, t.Heading},
+		{"selection", &compiled.Selection, t.Selection},
+		{"error", &compiled.Error, t.Error},
+		{"muted", &compiled.Muted, t.Muted},
+		{"code", &compiled.Code, t.Code},
+	} {
+		style, err := parseStyle(f.spec)
+		if err != nil {
+			return compiled, fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.dst = style
+	}
+	if _, ok := styles.Registry[t.ChromaStyle]; !ok {
+		return compiled, fmt.Errorf("chroma_style: unknown style %q", t.ChromaStyle)
+	}
+	return compiled, nil
+}
+
+// parseStyle turns a style spec such as "bold 231 on 24" into the escapes
+// that switch it on and off again.
+func parseStyle(spec string) (sgrStyle, error) {
+	attributes := map[string][2]string{
+		"bold":      {"1", "22"},
+		"dim":       {"2", "22"},
+		"italic":    {"3", "23"},
+		"underline": {"4", "24"},
+		"reverse":   {"7", "27"},
+	}
+	var on, off []string
+	fields := strings.Fields(spec)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if codes, ok := attributes[field]; ok {
+			on = append(on, codes[0])
+			off = append(off, codes[1])
+			continue
+		}
+		background := false
+		if field == "on" {
+			if i+1 == len(fields) {
+				return sgrStyle{}, fmt.Errorf("%q: missing colour after \"on\"", spec)
+			}
+			i++
+			field = fields[i]
+			background = true
+		}
+		params, ok := colorParams(field, background)
+		if !ok {
+			return sgrStyle{}, fmt.Errorf("%q: invalid colour or attribute %q", spec, field)
+		}
+		on = append(on, params)
+		if background {
+			off = append(off, "49")
+		} else {
+			off = append(off, "39")
+		}
+	}
+	if len(on) == 0 {
+		return sgrStyle{}, nil
+	}
+	return sgrStyle{"\033[" + strings.Join(on, ";") + "m", "\033[" + strings.Join(off, ";") + "m"}, nil
+}
+
+// paint wraps text in a style.
+func (s sgrStyle) paint(text string) string {
+	if s.on == "" {
+		return text
+	}
+	return s.on + text + s.off
+}
+
+// noColor is set when output must not contain escape sequences.
+var noColor bool
+
+// colorSupported reports whether stdout is a terminal that takes colours
+// and NO_COLOR is not set.
+func colorSupported() bool {
+	return termenv.NewOutput(os.Stdout).EnvColorProfile() != termenv.Ascii
+}
+
+// disableColor switches every style to plain text. Inline markup falls
+// back to ASCII emphasis, and code blocks are numbered instead of
+// highlighted.
+func disableColor() {
+	noColor = true
+	reset = ""
+	palette = themeStyles{
+		Code:        sgrStyle{"`", "`"},
+		ChromaStyle: palette.ChromaStyle,
+	}
+	styleBold = sgrStyle{"*", "*"}
+	styleItalic = sgrStyle{"_", "_"}
+	styleUnderline = sgrStyle{}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Types can be nested deck paths such as "go::concurrency::channels". In
+// group mode they are shown as a tree where every node counts the questions
+// of its whole subtree.
+const deckSeparator = "::"
+
+type groupRow struct {
+	Path        string
+	Name        string
+	Depth       int
+	Count       int
+	Description string
+	HasChildren bool
+	Expanded    bool
+}
+
+type groupNode struct {
+	path     string
+	name     string
+	count    int
+	children []*groupNode
+}
+
+// groupRows flattens groups into the rows currently visible in group mode.
+// While a search query is active every node on the way to a match is shown
+// expanded.
+func groupRows(groups []TypeGroup, hierarchical bool, expanded map[string]bool, query string) []groupRow {
+	if !hierarchical {
+		filtered := filterGroups(groups, query)
+		rows := make([]groupRow, 0, len(filtered))
+		for _, g := range filtered {
+			rows = append(rows, groupRow{Path: g.Type, Name: g.Type, Count: g.Count})
+		}
+		return rows
+	}
+
+	var roots []*groupNode
+	nodes := make(map[string]*groupNode)
+	for _, g := range groups {
+		parts := strings.Split(g.Type, deckSeparator)
+		var parent *groupNode
+		for i := range parts {
+			path := strings.Join(parts[:i+1], deckSeparator)
+			node, ok := nodes[path]
+			if !ok {
+				node = &groupNode{path: path, name: parts[i]}
+				nodes[path] = node
+				if parent == nil {
+					roots = append(roots, node)
+				} else {
+					parent.children = append(parent.children, node)
+				}
+			}
+			node.count += g.Count
+			parent = node
+		}
+	}
+
+	needle := strings.ToLower(strings.TrimSpace(query))
+	var rows []groupRow
+	var walk func(nodes []*groupNode, depth int)
+	walk = func(nodes []*groupNode, depth int) {
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+		for _, node := range nodes {
+			if needle != "" && !node.matches(needle) {
+				continue
+			}
+			open := needle != "" || expanded[node.path]
+			rows = append(rows, groupRow{
+				Path:        node.path,
+				Name:        node.name,
+				Depth:       depth,
+				Count:       node.count,
+				HasChildren: len(node.children) > 0,
+				Expanded:    open && len(node.children) > 0,
+			})
+			if open {
+				walk(node.children, depth+1)
+			}
+		}
+	}
+	walk(roots, 0)
+	return rows
+}
+
+func (n *groupNode) matches(needle string) bool {
+	if strings.Contains(strings.ToLower(n.path), needle) {
+		return true
+	}
+	for _, child := range n.children {
+		if child.matches(needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentRow returns the index of the row's parent, or -1 for a top-level
+// row.
+func parentRow(rows []groupRow, index int) int {
+	for i := index - 1; i >= 0; i-- {
+		if rows[i].Depth < rows[index].Depth {
+			return i
+		}
+	}
+	return -1
+}
+
+// typeMatches reports whether qType is deckPath or one of its sub-decks.
+func typeMatches(qType, deckPath string) bool {
+	return qType == deckPath || strings.HasPrefix(qType, deckPath+deckSeparator)
+}